@@ -11,6 +11,7 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/spf13/cobra"
@@ -18,6 +19,7 @@ import (
 	"go.uber.org/zap/zapcore"
 
 	"github.com/siderolabs/talos-metal-agent/internal/agent"
+	"github.com/siderolabs/talos-metal-agent/internal/bmc"
 	internalconfig "github.com/siderolabs/talos-metal-agent/internal/config"
 	"github.com/siderolabs/talos-metal-agent/internal/version"
 	"github.com/siderolabs/talos-metal-agent/pkg/config"
@@ -49,7 +51,7 @@ var rootCmd = &cobra.Command{
 		conf := internalconfig.LoadFromKernelCmdline(logger)
 
 		if rootCmdArgs.providerAddress != "" {
-			conf.ProviderAddress = rootCmdArgs.providerAddress
+			conf.ProviderAddresses = strings.Split(rootCmdArgs.providerAddress, ",")
 		}
 
 		if cmd.Flags().Changed(testModeFlag) {
@@ -58,12 +60,12 @@ var rootCmd = &cobra.Command{
 
 		defer logger.Sync() //nolint:errcheck
 
-		return run(cmd.Context(), conf.ProviderAddress, conf.TestMode, logger)
+		return run(cmd.Context(), conf.ProviderAddresses, conf.ProviderIdentity, conf.SigningKeyPath, conf.SideroLinkAPI, conf.TestMode, conf.BMCBackend, conf.Redfish, conf.Verify, conf.TunnelStatusAddress, logger)
 	},
 }
 
-func run(ctx context.Context, providerAddress string, testMode bool, logger *zap.Logger) error {
-	ag, err := agent.New(providerAddress, testMode, logger)
+func run(ctx context.Context, providerAddresses []string, providerIdentity, signingKeyPath, sideroLinkAPI string, testMode bool, bmcBackend bmc.Backend, redfishOptions bmc.RedfishOptions, verify internalconfig.VerifyOptions, tunnelStatusAddress string, logger *zap.Logger) error {
+	ag, err := agent.New(providerAddresses, providerIdentity, signingKeyPath, sideroLinkAPI, testMode, bmcBackend, redfishOptions, verify, tunnelStatusAddress, logger)
 	if err != nil {
 		return fmt.Errorf("failed to create agent: %w", err)
 	}
@@ -105,7 +107,8 @@ func runCmd() error {
 
 func init() {
 	rootCmd.Flags().StringVar(&rootCmdArgs.providerAddress, "provider-address", "", fmt.Sprintf(
-		"The infra provider address to connect to. If not specified explicitly, the value of the kernel arg %q will be used.", config.MetalProviderAddressKernelArg))
+		"The infra provider address(es) to connect to, comma-separated; tried in order with automatic failover. "+
+			"If not specified explicitly, the value of the kernel arg %q will be used.", config.MetalProviderAddressKernelArg))
 	rootCmd.Flags().BoolVar(&rootCmdArgs.testMode, testModeFlag, false, "Enable test mode. In this mode, "+
 		"the agent will assume that the power management is done via an external API (e.g., the power API served by 'talosctl cluster create').")
 	rootCmd.Flags().BoolVar(&rootCmdArgs.debug, "debug", false, "Enable debug mode & logs.")
@@ -7,47 +7,78 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 
 	"github.com/cosi-project/runtime/pkg/safe"
 	"github.com/cosi-project/runtime/pkg/state"
 	"github.com/jhump/grpctunnel"
-	"github.com/jhump/grpctunnel/tunnelpb"
 	"github.com/siderolabs/talos/pkg/grpc/middleware/authz"
 	talosclient "github.com/siderolabs/talos/pkg/machinery/client"
 	talosconstants "github.com/siderolabs/talos/pkg/machinery/constants"
 	"github.com/siderolabs/talos/pkg/machinery/resources/hardware"
 	talosrole "github.com/siderolabs/talos/pkg/machinery/role"
 	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
 
 	agentpb "github.com/siderolabs/talos-metal-agent/api/agent"
-	"github.com/siderolabs/talos-metal-agent/internal/ipmi"
+	"github.com/siderolabs/talos-metal-agent/internal/bmc"
+	internalconfig "github.com/siderolabs/talos-metal-agent/internal/config"
 	"github.com/siderolabs/talos-metal-agent/internal/service"
+	"github.com/siderolabs/talos-metal-agent/internal/tunnel"
+	"github.com/siderolabs/talos-metal-agent/pkg/auth"
+	"github.com/siderolabs/talos-metal-agent/pkg/cmdverify"
 	"github.com/siderolabs/talos-metal-agent/pkg/constants"
+	"github.com/siderolabs/talos-metal-agent/pkg/siderolink"
 )
 
 // Agent is the Talos agent.
 type Agent struct {
-	logger          *zap.Logger
-	providerAddress string
-	testMode        bool
+	logger            *zap.Logger
+	providerAddresses []string
+	providerIdentity  string
+	signingKeyPath    string
+	sideroLinkAPI     string
+	testMode          bool
+	bmcBackend        bmc.Backend
+	redfishOptions    bmc.RedfishOptions
+	// verifier validates the configured trust root and transparency log public key eagerly, so a
+	// misconfigured verify setup is reported at startup instead of at the first destructive
+	// command, and gates service.Server's destructive RPCs via Check. See pkg/cmdverify's package
+	// doc for why Check can't yet be handed a real signed envelope, and why cmdverify.New still
+	// refuses cmdverify.ModeEnforce until it can.
+	verifier            *cmdverify.Verifier
+	tunnelStatusAddress string
 }
 
 // New creates a new agent.
-func New(providerAddress string, testMode bool, logger *zap.Logger) (*Agent, error) {
+func New(providerAddresses []string, providerIdentity, signingKeyPath, sideroLinkAPI string, testMode bool, bmcBackend bmc.Backend, redfishOptions bmc.RedfishOptions, verify internalconfig.VerifyOptions, tunnelStatusAddress string, logger *zap.Logger) (*Agent, error) {
+	verifier, err := cmdverify.New(verify.Mode, verify.TrustRootPEM, verify.LogPublicKey, verify.LogURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create command verifier: %w", err)
+	}
+
 	return &Agent{
-		providerAddress: providerAddress,
-		testMode:        testMode,
-		logger:          logger,
+		providerAddresses:   providerAddresses,
+		providerIdentity:    providerIdentity,
+		signingKeyPath:      signingKeyPath,
+		sideroLinkAPI:       sideroLinkAPI,
+		testMode:            testMode,
+		bmcBackend:          bmcBackend,
+		redfishOptions:      redfishOptions,
+		verifier:            verifier,
+		tunnelStatusAddress: tunnelStatusAddress,
+		logger:              logger,
 	}, nil
 }
 
 // Run starts the agent.
 func (a *Agent) Run(ctx context.Context) error {
-	a.logger.Info("running metal agent", zap.String("provider_address", a.providerAddress), zap.Bool("test_mode", a.testMode))
+	a.logger.Info("running metal agent", zap.Strings("provider_addresses", a.providerAddresses), zap.Bool("test_mode", a.testMode))
 
 	talosClient, err := buildTalosClient(ctx)
 	if err != nil {
@@ -68,34 +99,94 @@ func (a *Agent) Run(ctx context.Context) error {
 
 	a.logger.Info("connected to Talos", zap.String("version", versionResponse.Messages[0].String()), zap.String("machine_uuid", machineID))
 
-	providerDialOptions := []grpc.DialOption{
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithUnaryInterceptor(idHeaderUnaryInterceptor(machineID)),
-		grpc.WithStreamInterceptor(idHeaderStreamInterceptor(machineID)),
+	identity := a.providerIdentity
+	if identity == "" {
+		identity = machineID
 	}
 
-	providerConn, err := grpc.NewClient(a.providerAddress, providerDialOptions...)
+	signer, err := auth.LoadOrGenerateKey(a.signingKeyPath, identity)
 	if err != nil {
-		return fmt.Errorf("failed to create grpc client: %w", err)
+		return fmt.Errorf("failed to load or generate provider signing key: %w", err)
 	}
 
-	tunnelStub := tunnelpb.NewTunnelServiceClient(providerConn)
-	channelServer := grpctunnel.NewReverseTunnelServer(tunnelStub)
+	providerDialOptions := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(idHeaderUnaryInterceptor(machineID), auth.UnaryClientInterceptor(identity, signer)),
+		grpc.WithChainStreamInterceptor(idHeaderStreamInterceptor(machineID), auth.StreamClientInterceptor(identity, signer)),
+	}
 
-	ipmiClientFactory := func() (service.IPMIClient, error) {
-		return ipmi.NewLocalClient()
+	if a.sideroLinkAPI != "" {
+		link, linkErr := a.bringUpSideroLink(ctx, machineID)
+		if linkErr != nil {
+			return fmt.Errorf("failed to bring up SideroLink tunnel: %w", linkErr)
+		}
+
+		defer link.Close()
+
+		providerDialOptions = append(providerDialOptions, grpc.WithContextDialer(link.DialContext))
 	}
 
-	serviceServer := service.NewServer(talosClient, ipmiClientFactory, a.testMode, a.logger)
+	bmcClientFactory := bmc.NewFactory(a.bmcBackend, a.redfishOptions)
+
+	serviceServer := service.NewServer(talosClient, bmcClientFactory, machineID, a.testMode, a.verifier, a.logger)
+
+	supervisor := tunnel.NewSupervisor(a.providerAddresses, providerDialOptions, func(channelServer *grpctunnel.ReverseTunnelServer) {
+		agentpb.RegisterAgentServiceServer(channelServer, serviceServer)
+	}, a.logger)
+
+	statusServer := &http.Server{Addr: a.tunnelStatusAddress, Handler: supervisor.StatusHandler()}
+
+	group, groupCtx := errgroup.WithContext(ctx)
+
+	group.Go(func() error {
+		if err := supervisor.Run(groupCtx); err != nil {
+			return fmt.Errorf("failed to serve over grpc tunnel: %w", err)
+		}
 
-	agentpb.RegisterAgentServiceServer(channelServer, serviceServer)
+		return nil
+	})
 
-	// Open the reverse tunnel and serve requests.
-	if _, err = channelServer.Serve(ctx); err != nil {
-		return fmt.Errorf("failed to serve over grpc tunnel: %w", err)
+	group.Go(func() error {
+		a.logger.Info("serving tunnel status endpoint", zap.String("address", a.tunnelStatusAddress))
+
+		if err := statusServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("failed to serve tunnel status endpoint: %w", err)
+		}
+
+		return nil
+	})
+
+	group.Go(func() error {
+		<-groupCtx.Done()
+
+		return statusServer.Close()
+	})
+
+	return group.Wait()
+}
+
+// bringUpSideroLink generates a WireGuard keypair, exchanges it with the provider's SideroLink
+// API for a peer configuration, and brings up the userspace WireGuard tunnel the reverse tunnel
+// connection is then dialed over.
+func (a *Agent) bringUpSideroLink(ctx context.Context, machineID string) (*siderolink.Link, error) {
+	privateKey, publicKey, err := siderolink.GenerateKeyPair()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate WireGuard keypair: %w", err)
 	}
 
-	return nil
+	peer, err := siderolink.Provision(ctx, a.sideroLinkAPI, machineID, publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to provision SideroLink peer: %w", err)
+	}
+
+	link, err := siderolink.Up(privateKey, *peer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bring up WireGuard link: %w", err)
+	}
+
+	a.logger.Info("brought up SideroLink tunnel", zap.String("address", peer.Address), zap.String("endpoint", peer.ServerEndpoint))
+
+	return link, nil
 }
 
 type talosClientWrapper struct {
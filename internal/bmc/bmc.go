@@ -0,0 +1,86 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package bmc selects and constructs the right BMC backend (IPMI, Redfish, ...) for the machine
+// the agent is running on.
+package bmc
+
+import (
+	"fmt"
+
+	"github.com/siderolabs/talos-metal-agent/internal/ipmi"
+	"github.com/siderolabs/talos-metal-agent/internal/null"
+	"github.com/siderolabs/talos-metal-agent/internal/redfish"
+	"github.com/siderolabs/talos-metal-agent/internal/service"
+)
+
+// Backend identifies a BMC management protocol.
+type Backend string
+
+const (
+	// BackendAuto probes the machine's BMC and picks the best available backend.
+	BackendAuto Backend = "auto"
+	// BackendIPMI uses IPMI-over-LAN.
+	BackendIPMI Backend = "ipmi"
+	// BackendRedfish uses the Redfish HTTP API.
+	BackendRedfish Backend = "redfish"
+	// BackendNull talks to no hardware at all, for development and testing against a machine with
+	// no real BMC.
+	BackendNull Backend = "null"
+)
+
+// RedfishOptions carries the Redfish connection details read from the kernel command line, used
+// when Backend is BackendRedfish or BackendAuto. SetPowerManagement does not change them.
+type RedfishOptions struct {
+	Scheme             string
+	Address            string
+	Username           string
+	Password           string
+	InsecureSkipVerify bool
+}
+
+// NewFactory returns a service.BMCClientFactory that constructs a client for the configured
+// backend, auto-detecting between IPMI and Redfish when backend is BackendAuto.
+func NewFactory(backend Backend, redfishOptions RedfishOptions) service.BMCClientFactory {
+	return func() (service.BMCClient, error) {
+		switch backend {
+		case BackendIPMI:
+			return ipmi.NewLocalClient()
+		case BackendRedfish:
+			return newRedfishClient(redfishOptions)
+		case BackendNull:
+			return null.NewClient()
+		case BackendAuto:
+			return probe(redfishOptions)
+		default:
+			return nil, fmt.Errorf("unknown bmc backend %q", backend)
+		}
+	}
+}
+
+// probe tries IPMI-over-LAN first, as that's the historically supported path, and falls back to
+// Redfish when the local IPMI device isn't usable (common on servers that ship with IPMI-over-LAN
+// disabled but Redfish enabled).
+func probe(redfishOptions RedfishOptions) (service.BMCClient, error) {
+	ipmiClient, err := ipmi.NewLocalClient()
+	if err == nil {
+		return ipmiClient, nil
+	}
+
+	if redfishOptions.Address == "" {
+		return nil, fmt.Errorf("no local IPMI device available and no redfish address configured: %w", err)
+	}
+
+	return newRedfishClient(redfishOptions)
+}
+
+func newRedfishClient(redfishOptions RedfishOptions) (service.BMCClient, error) {
+	return redfish.NewClient(redfish.Options{
+		Scheme:             redfishOptions.Scheme,
+		Address:            redfishOptions.Address,
+		Username:           redfishOptions.Username,
+		Password:           redfishOptions.Password,
+		InsecureSkipVerify: redfishOptions.InsecureSkipVerify,
+	})
+}
@@ -6,23 +6,44 @@
 package config
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"os"
 	"strconv"
+	"strings"
 
 	"github.com/siderolabs/go-procfs/procfs"
 	"go.uber.org/zap"
 
+	"github.com/siderolabs/talos-metal-agent/internal/bmc"
+	"github.com/siderolabs/talos-metal-agent/pkg/cmdverify"
 	"github.com/siderolabs/talos-metal-agent/pkg/config"
 )
 
 // Config contains the configuration for the agent.
 type Config struct {
-	ProviderAddress string
-	TestMode        bool
+	ProviderAddresses   []string
+	ProviderIdentity    string
+	SigningKeyPath      string
+	SideroLinkAPI       string
+	TestMode            bool
+	BMCBackend          bmc.Backend
+	Redfish             bmc.RedfishOptions
+	Verify              VerifyOptions
+	TunnelStatusAddress string
+}
+
+// VerifyOptions configures cmdverify.Verifier for destructive provider commands.
+type VerifyOptions struct {
+	Mode         cmdverify.Mode
+	TrustRootPEM []byte
+	LogURL       string
+	LogPublicKey ed25519.PublicKey
 }
 
 // LoadFromKernelCmdline loads the Config from the kernel arguments.
 func LoadFromKernelCmdline(logger *zap.Logger) Config {
-	var providerAddress string
+	var providerAddresses []string
 
 	cmdline := procfs.ProcCmdline()
 
@@ -30,7 +51,46 @@ func LoadFromKernelCmdline(logger *zap.Logger) Config {
 	if providerAddressParam != nil {
 		providerAddressVal := providerAddressParam.First()
 		if providerAddressVal != nil {
-			providerAddress = *providerAddressVal
+			providerAddresses = splitAddresses(*providerAddressVal)
+		}
+	}
+
+	tunnelStatusAddress := config.DefaultTunnelStatusAddress
+
+	tunnelStatusAddressParam := cmdline.Get(config.MetalProviderTunnelStatusAddressKernelArg)
+	if tunnelStatusAddressParam != nil {
+		if tunnelStatusAddressVal := tunnelStatusAddressParam.First(); tunnelStatusAddressVal != nil {
+			tunnelStatusAddress = *tunnelStatusAddressVal
+		}
+	}
+
+	var providerIdentity string
+
+	providerIdentityParam := cmdline.Get(config.MetalProviderIdentityKernelArg)
+	if providerIdentityParam != nil {
+		providerIdentityVal := providerIdentityParam.First()
+		if providerIdentityVal != nil {
+			providerIdentity = *providerIdentityVal
+		}
+	}
+
+	signingKeyPath := config.DefaultSigningKeyPath
+
+	signingKeyPathParam := cmdline.Get(config.MetalProviderSigningKeyPathKernelArg)
+	if signingKeyPathParam != nil {
+		signingKeyPathVal := signingKeyPathParam.First()
+		if signingKeyPathVal != nil {
+			signingKeyPath = *signingKeyPathVal
+		}
+	}
+
+	var sideroLinkAPI string
+
+	sideroLinkAPIParam := cmdline.Get(config.SideroLinkAPIKernelArg)
+	if sideroLinkAPIParam != nil {
+		sideroLinkAPIVal := sideroLinkAPIParam.First()
+		if sideroLinkAPIVal != nil {
+			sideroLinkAPI = *sideroLinkAPIVal
 		}
 	}
 
@@ -49,8 +109,123 @@ func LoadFromKernelCmdline(logger *zap.Logger) Config {
 		}
 	}
 
+	bmcBackend := bmc.BackendAuto
+
+	bmcBackendParam := cmdline.Get(config.BMCBackendKernelArg)
+	if bmcBackendParam != nil {
+		if bmcBackendVal := bmcBackendParam.First(); bmcBackendVal != nil {
+			bmcBackend = bmc.Backend(*bmcBackendVal)
+		}
+	}
+
 	return Config{
-		ProviderAddress: providerAddress,
-		TestMode:        testMode,
+		ProviderAddresses:   providerAddresses,
+		ProviderIdentity:    providerIdentity,
+		SigningKeyPath:      signingKeyPath,
+		SideroLinkAPI:       sideroLinkAPI,
+		TestMode:            testMode,
+		BMCBackend:          bmcBackend,
+		Redfish:             loadRedfishOptions(cmdline, logger),
+		Verify:              loadVerifyOptions(cmdline, logger),
+		TunnelStatusAddress: tunnelStatusAddress,
 	}
 }
+
+// splitAddresses splits a comma-separated list of provider addresses, trimming whitespace and
+// dropping empty entries.
+func splitAddresses(addresses string) []string {
+	var result []string
+
+	for _, address := range strings.Split(addresses, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			result = append(result, address)
+		}
+	}
+
+	return result
+}
+
+// loadVerifyOptions loads the cmdverify.Verifier configuration used to check destructive provider
+// commands.
+func loadVerifyOptions(cmdline *procfs.Cmdline, logger *zap.Logger) VerifyOptions {
+	opts := VerifyOptions{Mode: cmdverify.ModeOff}
+
+	if modeParam := cmdline.Get(config.MetalProviderVerifyModeKernelArg); modeParam != nil {
+		if modeVal := modeParam.First(); modeVal != nil {
+			opts.Mode = cmdverify.Mode(*modeVal)
+		}
+	}
+
+	if trustRootParam := cmdline.Get(config.MetalProviderVerifyTrustRootKernelArg); trustRootParam != nil {
+		if trustRootPath := trustRootParam.First(); trustRootPath != nil {
+			pem, err := os.ReadFile(*trustRootPath)
+			if err != nil {
+				logger.Error("failed to read verify trust root", zap.String("path", *trustRootPath), zap.Error(err))
+			} else {
+				opts.TrustRootPEM = pem
+			}
+		}
+	}
+
+	if logURLParam := cmdline.Get(config.MetalProviderVerifyLogURLKernelArg); logURLParam != nil {
+		if logURLVal := logURLParam.First(); logURLVal != nil {
+			opts.LogURL = *logURLVal
+		}
+	}
+
+	if logPubKeyParam := cmdline.Get(config.MetalProviderVerifyLogPublicKeyKernelArg); logPubKeyParam != nil {
+		if logPubKeyVal := logPubKeyParam.First(); logPubKeyVal != nil {
+			pubKey, err := base64.StdEncoding.DecodeString(*logPubKeyVal)
+			if err != nil {
+				logger.Error("failed to decode verify log public key", zap.Error(err))
+			} else {
+				opts.LogPublicKey = pubKey
+			}
+		}
+	}
+
+	return opts
+}
+
+// loadRedfishOptions loads the Redfish connection details the Redfish backend uses to authenticate
+// against the BMC's Redfish API.
+func loadRedfishOptions(cmdline *procfs.Cmdline, logger *zap.Logger) bmc.RedfishOptions {
+	var opts bmc.RedfishOptions
+
+	if addressParam := cmdline.Get(config.BMCRedfishAddressKernelArg); addressParam != nil {
+		if addressVal := addressParam.First(); addressVal != nil {
+			opts.Address = *addressVal
+		}
+	}
+
+	if schemeParam := cmdline.Get(config.BMCRedfishSchemeKernelArg); schemeParam != nil {
+		if schemeVal := schemeParam.First(); schemeVal != nil {
+			opts.Scheme = *schemeVal
+		}
+	}
+
+	if usernameParam := cmdline.Get(config.BMCRedfishUsernameKernelArg); usernameParam != nil {
+		if usernameVal := usernameParam.First(); usernameVal != nil {
+			opts.Username = *usernameVal
+		}
+	}
+
+	if passwordParam := cmdline.Get(config.BMCRedfishPasswordKernelArg); passwordParam != nil {
+		if passwordVal := passwordParam.First(); passwordVal != nil {
+			opts.Password = *passwordVal
+		}
+	}
+
+	if insecureParam := cmdline.Get(config.BMCRedfishInsecureSkipVerifyKernelArg); insecureParam != nil {
+		if insecureVal := insecureParam.First(); insecureVal != nil {
+			insecureSkipVerify, err := strconv.ParseBool(*insecureVal)
+			if err != nil {
+				logger.Error("failed to parse redfish insecure skip verify", zap.String("key", config.BMCRedfishInsecureSkipVerifyKernelArg), zap.String("value", *insecureVal), zap.Error(err))
+			} else {
+				opts.InsecureSkipVerify = insecureSkipVerify
+			}
+		}
+	}
+
+	return opts
+}
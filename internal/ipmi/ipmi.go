@@ -6,8 +6,10 @@
 package ipmi
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"net"
 	"strings"
 
@@ -20,6 +22,7 @@ import (
 // Client is a holder for the ipmiClient.
 type Client struct {
 	ipmiClient *ipmi.Client
+	ctx        context.Context //nolint:containedctx // the BMCClient interface this wraps is not context-aware
 }
 
 // NewLocalClient creates a new local ipmi client to use.
@@ -29,51 +32,24 @@ func NewLocalClient() (*Client, error) {
 		return nil, err
 	}
 
-	if err = ipmiClient.Connect(); err != nil {
+	ctx := context.Background()
+
+	if err = ipmiClient.Connect(ctx); err != nil {
 		return nil, err
 	}
 
-	return &Client{ipmiClient: ipmiClient}, nil
+	return &Client{ipmiClient: ipmiClient, ctx: ctx}, nil
 }
 
 // Close the client.
 func (c *Client) Close() error {
-	return c.ipmiClient.Close()
+	return c.ipmiClient.Close(c.ctx)
 }
 
 // AttemptUserSetup attempts to set up an IPMI user with the given username.
 func (c *Client) AttemptUserSetup(username, password string, logger *zap.Logger) error {
-	id, exists, err := c.findUserIDByName(username)
-	if err != nil {
-		return err
-	}
-
-	c.ipmiClient.sl
-
-	users, err := c.ipmiClient.ListUser(0x01)
-	if err != nil {
-		return err
-	}
-
-	exists := false
-	userID := uint8(0)
-
-	for _, user := range users {
-		if user.ID == 1 {
-			continue // skip the default admin user
-		}
-
-		if user.Name == username {
-			userID = user.ID
-			exists = true
-
-			break
-		}
-
-	}
-
 	// Get user summary to see how many user slots
-	userAccessResp, err := c.ipmiClient.GetUserAccess(0x01, 0x01)
+	userAccessResp, err := c.ipmiClient.GetUserAccess(c.ctx, 0x01, 0x01)
 	if err != nil {
 		return err
 	}
@@ -84,7 +60,7 @@ func (c *Client) AttemptUserSetup(username, password string, logger *zap.Logger)
 	userID := uint8(0)
 
 	for i := uint8(2); i <= userAccessResp.MaxUsersIDCount; i++ {
-		userRes, userErr := c.ipmiClient.GetUsername(i)
+		userRes, userErr := c.ipmiClient.GetUsername(c.ctx, i)
 		if userErr != nil {
 			// nb: A failure here actually seems to mean that the user slot is unused,
 			// even though you can also have a slot with empty user as well. *scratches head*
@@ -121,16 +97,16 @@ func (c *Client) AttemptUserSetup(username, password string, logger *zap.Logger)
 	if !exists {
 		logger.Info("adding user to slot", zap.Uint8("slot", userID))
 
-		if _, err = c.ipmiClient.SetUsername(userID, username); err != nil {
+		if _, err = c.ipmiClient.SetUsername(c.ctx, userID, username); err != nil {
 			return err
 		}
 	}
 
-	if _, err = c.ipmiClient.SetUserPassword(userID, password, false); err != nil {
+	if _, err = c.ipmiClient.SetUserPassword(c.ctx, userID, password, false); err != nil {
 		return err
 	}
 
-	if _, err = c.ipmiClient.SetUserAccess(&ipmi.SetUserAccessRequest{
+	if _, err = c.ipmiClient.SetUserAccess(c.ctx, &ipmi.SetUserAccessRequest{
 		EnableChanging:      true,
 		EnableIPMIMessaging: true,
 		ChannelNumber:       0x01,
@@ -141,11 +117,11 @@ func (c *Client) AttemptUserSetup(username, password string, logger *zap.Logger)
 		return err
 	}
 
-	return c.ipmiClient.EnableUser(userID)
+	return c.ipmiClient.EnableUser(c.ctx, userID)
 }
 
 func (c *Client) findUserIDByName(username string) (uint8, bool, error) {
-	users, err := c.ipmiClient.ListUser(0x01)
+	users, err := c.ipmiClient.GetUsers(c.ctx, 0x01)
 	if err != nil {
 		return 0, false, err
 	}
@@ -169,20 +145,173 @@ func (c *Client) UserExists(username string) (bool, error) {
 	return exists, nil
 }
 
+// defaultRMCPPort is the standard RMCP/IPMI-over-LAN port, used as a fallback when the BMC does
+// not report a primary RMCP port lan config parameter.
+const defaultRMCPPort = 623
+
 // GetIPPort returns the IPMI IP and port.
 func (c *Client) GetIPPort() (ip string, port uint16, err error) {
-	ipResp, err := c.ipmiClient.GetLanConfigParams(0x01, 0x03)
+	params, err := c.ipmiClient.GetLanConfigParams(c.ctx, 0x01)
 	if err != nil {
 		return "", 0, err
 	}
 
-	portResp, err := c.ipmiClient.GetLanConfigParams(0x01, 0x08)
-	if err != nil {
-		return "", 0, err
+	if params.IP == nil {
+		return "", 0, errors.New("BMC did not report a LAN IP address")
+	}
+
+	port = defaultRMCPPort
+
+	if params.PrimaryRMCPPort != nil {
+		port = params.PrimaryRMCPPort.Port
+	}
+
+	return params.IP.IP.String(), port, nil
+}
+
+// NetworkMode selects how the BMC LAN interface acquires its IP configuration.
+type NetworkMode int
+
+const (
+	// NetworkModeDHCP configures the BMC LAN interface to obtain its address via DHCP.
+	NetworkModeDHCP NetworkMode = iota
+	// NetworkModeStatic configures the BMC LAN interface with a fixed IP address.
+	NetworkModeStatic
+)
+
+// NetworkConfig describes the BMC LAN profile applied by EnsureLANConfig.
+type NetworkConfig struct {
+	Mode    NetworkMode
+	Address string
+	Netmask string
+	Gateway string
+	// VLANID is the 802.1Q VLAN tag the BMC LAN interface should use, or 0 to disable tagging.
+	VLANID uint16
+}
+
+// LAN Configuration Parameter selectors used by EnsureLANConfig, see table 23-4 of the IPMI spec.
+const (
+	lanParamIPAddress       = 0x03
+	lanParamIPAddressSource = 0x04
+	lanParamSubnetMask      = 0x06
+	lanParamDefaultGateway  = 0x0c
+	lanParamVLANID          = 0x14
+)
+
+// IP Address Source values for lanParamIPAddressSource.
+const (
+	ipAddressSourceStatic = 0x01
+	ipAddressSourceDHCP   = 0x02
+)
+
+// vlanEnableBit marks a VLAN ID as active in the two-byte VLAN ID lan config parameter.
+const vlanEnableBit = 0x8000
+
+// EnsureLANConfig pushes a full BMC LAN network profile (addressing mode, static address, mask,
+// gateway and VLAN tag) via the IPMI Set LAN Configuration Parameters command. Many freshly-racked
+// servers arrive with their BMC un-provisioned, so this lets the agent bring it onto the
+// management VLAN without a manual step.
+func (c *Client) EnsureLANConfig(cfg NetworkConfig) error {
+	source := uint8(ipAddressSourceDHCP)
+	if cfg.Mode == NetworkModeStatic {
+		source = ipAddressSourceStatic
+	}
+
+	if _, err := c.ipmiClient.SetLanConfigParam(c.ctx, 0x01, lanParamIPAddressSource, []byte{source}); err != nil {
+		return fmt.Errorf("failed to set BMC IP address source: %w", err)
 	}
 
-	ip = net.IP(ipResp.ConfigData).String()
-	port = binary.LittleEndian.Uint16(portResp.ConfigData)
+	if cfg.Mode == NetworkModeStatic {
+		if err := c.setStaticAddress(cfg); err != nil {
+			return err
+		}
+	}
+
+	return c.setVLAN(cfg.VLANID)
+}
+
+// setStaticAddress pushes the static IP address, subnet mask and default gateway lan config
+// parameters.
+func (c *Client) setStaticAddress(cfg NetworkConfig) error {
+	ip := net.ParseIP(cfg.Address).To4()
+	if ip == nil {
+		return fmt.Errorf("invalid BMC IP address %q", cfg.Address)
+	}
+
+	if _, err := c.ipmiClient.SetLanConfigParam(c.ctx, 0x01, lanParamIPAddress, ip); err != nil {
+		return fmt.Errorf("failed to set BMC IP address: %w", err)
+	}
+
+	mask := net.ParseIP(cfg.Netmask).To4()
+	if mask == nil {
+		return fmt.Errorf("invalid BMC subnet mask %q", cfg.Netmask)
+	}
+
+	if _, err := c.ipmiClient.SetLanConfigParam(c.ctx, 0x01, lanParamSubnetMask, mask); err != nil {
+		return fmt.Errorf("failed to set BMC subnet mask: %w", err)
+	}
+
+	gateway := net.ParseIP(cfg.Gateway).To4()
+	if gateway == nil {
+		return fmt.Errorf("invalid BMC gateway %q", cfg.Gateway)
+	}
+
+	if _, err := c.ipmiClient.SetLanConfigParam(c.ctx, 0x01, lanParamDefaultGateway, gateway); err != nil {
+		return fmt.Errorf("failed to set BMC default gateway: %w", err)
+	}
+
+	return nil
+}
+
+// setVLAN sets, or if vlanID is 0 clears, the 802.1Q VLAN tag used by the BMC LAN interface.
+func (c *Client) setVLAN(vlanID uint16) error {
+	data := make([]byte, 2)
+
+	value := vlanID
+	if vlanID != 0 {
+		value |= vlanEnableBit
+	}
+
+	binary.LittleEndian.PutUint16(data, value)
+
+	if _, err := c.ipmiClient.SetLanConfigParam(c.ctx, 0x01, lanParamVLANID, data); err != nil {
+		return fmt.Errorf("failed to set BMC VLAN: %w", err)
+	}
+
+	return nil
+}
+
+// solParamEnable is the SOL Configuration Parameter selector for the Enable parameter, see table
+// 26-2 of the IPMI spec.
+const solParamEnable = 0x01
+
+// SetSOLEnabled enables or disables Serial-over-LAN on the BMC's primary channel.
+func (c *Client) SetSOLEnabled(enabled bool) error {
+	var data byte
+	if enabled {
+		data = 0x01
+	}
+
+	if _, err := c.ipmiClient.SetSOLConfigParam(c.ctx, 0x01, solParamEnable, []byte{data}); err != nil {
+		return fmt.Errorf("failed to set SOL enabled=%t: %w", enabled, err)
+	}
+
+	return nil
+}
+
+// EnsureChannelAccess makes sure IPMI-over-LAN is always available (not just pre-boot) on the
+// primary channel and that the maximum privilege level allowed over it is administrator, so the
+// user AttemptUserSetup provisions can actually reach the BMC over the network.
+func (c *Client) EnsureChannelAccess() error {
+	if _, err := c.ipmiClient.SetChannelAccess(c.ctx, &ipmi.SetChannelAccessRequest{
+		ChannelNumber:     0x01,
+		AccessOption:      0x01, // set non-volatile, so the setting survives a BMC reset
+		AccessMode:        ipmi.ChannelAccessMode_AlwaysAvailable,
+		PrivilegeOption:   0x01,
+		MaxPrivilegeLevel: 0x04, // admin
+	}); err != nil {
+		return fmt.Errorf("failed to set channel access: %w", err)
+	}
 
-	return ip, port, nil
+	return nil
 }
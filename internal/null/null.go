@@ -0,0 +1,58 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package null implements a BMC backend that talks to no hardware at all, for development and
+// testing against a machine (or VM) that has no real IPMI or Redfish management interface.
+package null
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/siderolabs/talos-metal-agent/internal/ipmi"
+)
+
+// Client is a no-op BMC client: every call succeeds without touching any hardware.
+type Client struct{}
+
+// NewClient creates a new null Client.
+func NewClient() (*Client, error) {
+	return &Client{}, nil
+}
+
+// Close implements service.BMCClient.
+func (*Client) Close() error {
+	return nil
+}
+
+// UserExists implements service.BMCClient.
+func (*Client) UserExists(string) (bool, error) {
+	return true, nil
+}
+
+// AttemptUserSetup implements service.BMCClient.
+func (*Client) AttemptUserSetup(username string, _ string, logger *zap.Logger) error {
+	logger.Info("null BMC backend: pretending to set up user", zap.String("username", username))
+
+	return nil
+}
+
+// GetIPPort implements service.BMCClient.
+func (*Client) GetIPPort() (string, uint16, error) {
+	return "0.0.0.0", 0, nil
+}
+
+// EnsureLANConfig implements service.NetworkConfigurer.
+func (*Client) EnsureLANConfig(ipmi.NetworkConfig) error {
+	return nil
+}
+
+// SetSOLEnabled implements service.NetworkConfigurer.
+func (*Client) SetSOLEnabled(bool) error {
+	return nil
+}
+
+// EnsureChannelAccess implements service.NetworkConfigurer.
+func (*Client) EnsureChannelAccess() error {
+	return nil
+}
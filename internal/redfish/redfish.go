@@ -0,0 +1,235 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package redfish implements BMC management over the Redfish HTTP API, for servers that don't
+// expose (or don't reliably support) IPMI-over-LAN.
+package redfish
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const requestTimeout = 30 * time.Second
+
+// Client is a Redfish BMC client.
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+	address    string
+	username   string
+	password   string
+}
+
+// Options configures a Client.
+type Options struct {
+	// Scheme is the URL scheme to use, either "http" or "https". Defaults to "https".
+	Scheme string
+	// Address is the BMC address, e.g. "192.168.1.1:443".
+	Address string
+	// Username and Password are used for HTTP basic auth against the Redfish service root.
+	Username string
+	Password string
+	// InsecureSkipVerify disables TLS certificate verification, which many BMCs require as they
+	// ship with a self-signed certificate.
+	InsecureSkipVerify bool
+}
+
+// NewClient creates a new Redfish client.
+func NewClient(opts Options) (*Client, error) {
+	scheme := opts.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+
+	return &Client{
+		httpClient: &http.Client{
+			Timeout: requestTimeout,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: opts.InsecureSkipVerify}, //nolint:gosec
+			},
+		},
+		baseURL:  fmt.Sprintf("%s://%s/redfish/v1", scheme, opts.Address),
+		address:  opts.Address,
+		username: opts.Username,
+		password: opts.Password,
+	}, nil
+}
+
+// Close is a no-op for the Redfish client, which is not stateful.
+func (c *Client) Close() error {
+	return nil
+}
+
+// account is a partial representation of a Redfish AccountService account.
+type account struct {
+	UserName string `json:"UserName"`
+}
+
+type accountCollection struct {
+	Members []struct {
+		ODataID string `json:"@odata.id"`
+	} `json:"Members"`
+}
+
+// UserExists checks if the given username already has an account.
+func (c *Client) UserExists(username string) (bool, error) {
+	_, id, err := c.findAccount(username)
+	if err != nil {
+		return false, err
+	}
+
+	return id != "", nil
+}
+
+// AttemptUserSetup creates (or updates the password of) a Redfish account with administrator
+// privileges for the given username.
+func (c *Client) AttemptUserSetup(username, password string, logger *zap.Logger) error {
+	_, id, err := c.findAccount(username)
+	if err != nil {
+		return err
+	}
+
+	if id != "" {
+		logger.Info("redfish account already exists, updating password", zap.String("username", username))
+
+		return c.patchJSON(id, map[string]any{
+			"Password": password,
+		})
+	}
+
+	logger.Info("creating redfish account", zap.String("username", username))
+
+	return c.postJSON("/AccountService/Accounts", map[string]any{
+		"UserName": username,
+		"Password": password,
+		"RoleId":   "Administrator",
+		"Enabled":  true,
+	})
+}
+
+// GetIPPort returns the BMC's Redfish address and port.
+func (c *Client) GetIPPort() (string, uint16, error) {
+	address, port, found := strings.Cut(c.address, ":")
+	if !found {
+		return c.address, 443, nil
+	}
+
+	var portNum uint16
+
+	if _, err := fmt.Sscanf(port, "%d", &portNum); err != nil {
+		return "", 0, fmt.Errorf("failed to parse redfish port %q: %w", port, err)
+	}
+
+	return address, portNum, nil
+}
+
+func (c *Client) findAccount(username string) (*account, string, error) {
+	var collection accountCollection
+
+	if err := c.getJSON("/AccountService/Accounts", &collection); err != nil {
+		return nil, "", err
+	}
+
+	for _, member := range collection.Members {
+		var acc account
+
+		if err := c.getJSON(member.ODataID, &acc); err != nil {
+			return nil, "", err
+		}
+
+		if acc.UserName == username {
+			return &acc, member.ODataID, nil
+		}
+	}
+
+	return nil, "", nil
+}
+
+func (c *Client) getJSON(path string, out any) error {
+	req, err := c.newRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("redfish GET %s: %w", path, err)
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("redfish GET %s: unexpected status %d", path, resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *Client) postJSON(path string, body map[string]any) error {
+	return c.sendJSON(http.MethodPost, path, body, http.StatusCreated, http.StatusOK)
+}
+
+func (c *Client) patchJSON(path string, body map[string]any) error {
+	return c.sendJSON(http.MethodPatch, path, body, http.StatusOK, http.StatusNoContent)
+}
+
+func (c *Client) sendJSON(method, path string, body map[string]any, okStatuses ...int) error {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal redfish request body: %w", err)
+	}
+
+	req, err := c.newRequest(method, path, strings.NewReader(string(encoded)))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("redfish %s %s: %w", method, path, err)
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	for _, okStatus := range okStatuses {
+		if resp.StatusCode == okStatus {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("redfish %s %s: unexpected status %d", method, path, resp.StatusCode)
+}
+
+func (c *Client) newRequest(method, path string, body *strings.Reader) (*http.Request, error) {
+	url := path
+	if !strings.HasPrefix(path, "http") {
+		url = c.baseURL + strings.TrimPrefix(path, "/redfish/v1")
+	}
+
+	var reqBody *strings.Reader
+	if body != nil {
+		reqBody = body
+	} else {
+		reqBody = strings.NewReader("")
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), method, url, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build redfish request: %w", err)
+	}
+
+	req.SetBasicAuth(c.username, c.password)
+
+	return req, nil
+}
@@ -0,0 +1,290 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/siderolabs/talos/pkg/machinery/resources/block"
+	"github.com/siderolabs/talos/pkg/machinery/resources/hardware"
+	"github.com/siderolabs/talos/pkg/machinery/resources/network"
+	"go.uber.org/zap"
+
+	agentpb "github.com/siderolabs/talos-metal-agent/api/agent"
+)
+
+// dmiSysfsPath is where the kernel exposes SMBIOS/DMI facts that Talos doesn't surface as COSI
+// resources, e.g. the BIOS version and chassis type.
+const dmiSysfsPath = "/sys/class/dmi/id"
+
+// GetInventory collects a hardware inventory of the machine (SMBIOS/DMI, CPUs, memory, PCI
+// devices, NICs and disks) so the provider can populate a ServerHardware resource automatically at
+// first agent contact, instead of requiring users to type facts into machine specs.
+func (s *Server) GetInventory(ctx context.Context, req *agentpb.GetInventoryRequest) (*agentpb.GetInventoryResponse, error) {
+	s.logger.Debug("get inventory", zap.Bool("test_mode", s.testMode))
+
+	return runSingleflight[*agentpb.GetInventoryResponse](ctx, agentpb.AgentService_GetInventory_FullMethodName, &s.sf, req, func() (*agentpb.GetInventoryResponse, error) {
+		if s.testMode {
+			return &agentpb.GetInventoryResponse{}, nil
+		}
+
+		st := s.talosClient.State()
+
+		system, err := collectSystemInfo(ctx, st)
+		if err != nil {
+			return nil, fmt.Errorf("failed to collect system information: %w", err)
+		}
+
+		processors, err := collectProcessors(ctx, st)
+		if err != nil {
+			return nil, fmt.Errorf("failed to collect processor information: %w", err)
+		}
+
+		memoryModules, err := collectMemoryModules(ctx, st)
+		if err != nil {
+			return nil, fmt.Errorf("failed to collect memory module information: %w", err)
+		}
+
+		pciDevices, err := collectPCIDevices(ctx, st)
+		if err != nil {
+			return nil, fmt.Errorf("failed to collect PCI device information: %w", err)
+		}
+
+		nics, err := collectNICs(ctx, st)
+		if err != nil {
+			return nil, fmt.Errorf("failed to collect NIC information: %w", err)
+		}
+
+		disks, err := collectDisks(ctx, st, s.logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to collect disk information: %w", err)
+		}
+
+		return &agentpb.GetInventoryResponse{
+			System:        system,
+			Processors:    processors,
+			MemoryModules: memoryModules,
+			PciDevices:    pciDevices,
+			Nics:          nics,
+			Disks:         disks,
+		}, nil
+	})
+}
+
+// collectSystemInfo collects SMBIOS/DMI facts, combining the hardware.SystemInformation COSI resource
+// with the BIOS version and chassis type, which Talos doesn't expose as a resource.
+func collectSystemInfo(ctx context.Context, st state.State) (*agentpb.GetInventoryResponse_SystemInfo, error) {
+	info, err := safe.StateGetByID[*hardware.SystemInformation](ctx, st, hardware.SystemInformationID)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := info.TypedSpec()
+
+	return &agentpb.GetInventoryResponse_SystemInfo{
+		Manufacturer: spec.Manufacturer,
+		ProductName:  spec.ProductName,
+		Version:      spec.Version,
+		SerialNumber: spec.SerialNumber,
+		Uuid:         spec.UUID,
+		SkuNumber:    spec.SKUNumber,
+		BiosVersion:  readDMIAttr("bios_version"),
+		ChassisType:  readDMIAttr("chassis_type"),
+	}, nil
+}
+
+// readDMIAttr reads a single attribute from the kernel's DMI sysfs tree, returning an empty string
+// if it's missing, e.g. because the platform firmware doesn't expose it.
+func readDMIAttr(name string) string {
+	data, err := os.ReadFile(filepath.Join(dmiSysfsPath, name))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(data))
+}
+
+// collectProcessors collects the hardware.Processor COSI resources, one per populated CPU socket.
+func collectProcessors(ctx context.Context, st state.State) ([]*agentpb.GetInventoryResponse_Processor, error) {
+	list, err := safe.StateListAll[*hardware.Processor](ctx, st)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*agentpb.GetInventoryResponse_Processor, 0, list.Len())
+
+	for processor := range list.All() {
+		spec := processor.TypedSpec()
+
+		result = append(result, &agentpb.GetInventoryResponse_Processor{
+			Socket:       spec.Socket,
+			Manufacturer: spec.Manufacturer,
+			ProductName:  spec.ProductName,
+			CoreCount:    spec.CoreCount,
+			ThreadCount:  spec.ThreadCount,
+			MaxSpeedMhz:  spec.MaxSpeed,
+			SerialNumber: spec.SerialNumber,
+		})
+	}
+
+	return result, nil
+}
+
+// collectMemoryModules collects the hardware.MemoryModule COSI resources, one per populated DIMM slot.
+func collectMemoryModules(ctx context.Context, st state.State) ([]*agentpb.GetInventoryResponse_MemoryModule, error) {
+	list, err := safe.StateListAll[*hardware.MemoryModule](ctx, st)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*agentpb.GetInventoryResponse_MemoryModule, 0, list.Len())
+
+	for module := range list.All() {
+		spec := module.TypedSpec()
+
+		// Empty DIMM slots are reported with a zero size; skip them, as they hold no memory.
+		if spec.Size == 0 {
+			continue
+		}
+
+		result = append(result, &agentpb.GetInventoryResponse_MemoryModule{
+			DeviceLocator: spec.DeviceLocator,
+			BankLocator:   spec.BankLocator,
+			SizeMib:       spec.Size,
+			SpeedMhz:      spec.Speed,
+			Manufacturer:  spec.Manufacturer,
+			SerialNumber:  spec.SerialNumber,
+		})
+	}
+
+	return result, nil
+}
+
+// collectPCIDevices collects the hardware.PCIDevice COSI resources for every PCI device on the bus.
+func collectPCIDevices(ctx context.Context, st state.State) ([]*agentpb.GetInventoryResponse_PCIDevice, error) {
+	list, err := safe.StateListAll[*hardware.PCIDevice](ctx, st)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*agentpb.GetInventoryResponse_PCIDevice, 0, list.Len())
+
+	for device := range list.All() {
+		spec := device.TypedSpec()
+
+		result = append(result, &agentpb.GetInventoryResponse_PCIDevice{
+			Class:     spec.Class,
+			Subclass:  spec.Subclass,
+			Vendor:    spec.Vendor,
+			Product:   spec.Product,
+			VendorId:  spec.VendorID,
+			ProductId: spec.ProductID,
+		})
+	}
+
+	return result, nil
+}
+
+// collectNICs collects the physical network.LinkStatus COSI resources, skipping virtual links (bonds,
+// bridges, VLANs, ...) which aren't physical NICs.
+func collectNICs(ctx context.Context, st state.State) ([]*agentpb.GetInventoryResponse_NIC, error) {
+	list, err := safe.StateListAll[*network.LinkStatus](ctx, st)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*agentpb.GetInventoryResponse_NIC, 0, list.Len())
+
+	for link := range list.All() {
+		spec := link.TypedSpec()
+
+		if !spec.Physical() {
+			continue
+		}
+
+		result = append(result, &agentpb.GetInventoryResponse_NIC{
+			Name:          link.Metadata().ID(),
+			MacAddress:    net.HardwareAddr(spec.HardwareAddr).String(),
+			LinkUp:        spec.LinkState,
+			SpeedMbit:     uint32(spec.SpeedMegabits), //nolint:gosec
+			Driver:        spec.Driver,
+			DriverVersion: spec.DriverVersion,
+			Vendor:        spec.Vendor,
+			Product:       spec.Product,
+		})
+	}
+
+	return result, nil
+}
+
+// collectDisks collects the block.Disk COSI resources, augmented with a best-effort SMART health check,
+// which Talos doesn't surface as a resource.
+func collectDisks(ctx context.Context, st state.State, logger *zap.Logger) ([]*agentpb.GetInventoryResponse_Disk, error) {
+	list, err := safe.StateListAll[*block.Disk](ctx, st)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*agentpb.GetInventoryResponse_Disk, 0, list.Len())
+
+	for disk := range list.All() {
+		spec := disk.TypedSpec()
+
+		if spec.CDROM {
+			continue
+		}
+
+		result = append(result, &agentpb.GetInventoryResponse_Disk{
+			DevPath:     spec.DevPath,
+			Model:       spec.Model,
+			Serial:      spec.Serial,
+			Wwid:        spec.WWID,
+			SizeBytes:   spec.Size,
+			Transport:   spec.Transport,
+			Rotational:  spec.Rotational,
+			SmartHealth: smartHealth(ctx, spec.DevPath, logger),
+		})
+	}
+
+	return result, nil
+}
+
+// smartHealth best-effort queries the overall SMART health status of devPath via smartctl,
+// returning an empty string if smartctl isn't available or the device doesn't support SMART
+// (common for virtual/USB disks), rather than failing the whole inventory collection over it.
+func smartHealth(ctx context.Context, devPath string, logger *zap.Logger) string {
+	out, err := runCommand(ctx, "smartctl", "-H", "-j", devPath)
+	if err != nil {
+		logger.Debug("failed to query SMART health", zap.String("device", devPath), zap.Error(err))
+
+		return ""
+	}
+
+	var result struct {
+		SmartStatus struct {
+			Passed bool `json:"passed"`
+		} `json:"smart_status"`
+	}
+
+	if err = json.Unmarshal([]byte(out), &result); err != nil {
+		logger.Debug("failed to parse SMART health", zap.String("device", devPath), zap.Error(err))
+
+		return ""
+	}
+
+	if result.SmartStatus.Passed {
+		return "PASSED"
+	}
+
+	return "FAILED"
+}
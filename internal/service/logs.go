@@ -0,0 +1,193 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"regexp"
+	"time"
+
+	"github.com/siderolabs/talos/pkg/machinery/api/common"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	agentpb "github.com/siderolabs/talos-metal-agent/api/agent"
+)
+
+// StreamKernelLogs streams the machine's kernel (dmesg) log to the provider, resuming at the
+// sequence number the provider last saw so a reconnect after a BMC/agent restart doesn't
+// re-deliver (or drop) records.
+func (s *Server) StreamKernelLogs(req *agentpb.StreamKernelLogsRequest, stream agentpb.AgentService_StreamKernelLogsServer) error {
+	s.logger.Info("stream kernel logs", zap.Int64("resume_after_seq", req.GetResumeAfterSeq()))
+
+	// tail=false: the whole existing ring buffer is replayed, not just new messages, because
+	// forwardKmsgLines numbers records from the start of the stream - only a full replay lines
+	// those numbers up with the ones a previous stream delivered, so it can skip what the provider
+	// has already seen.
+	dmesgStream, err := s.talosClient.Dmesg(stream.Context(), true, false)
+	if err != nil {
+		return status.Errorf(codes.Internal, "error opening dmesg stream: %v", err)
+	}
+
+	return forwardKmsgLines(dmesgStream, req.GetResumeAfterSeq(), func(seq int64, record *kmsgRecord) error {
+		return stream.Send(&agentpb.KernelLogRecord{
+			MachineId: s.machineID,
+			Priority:  record.priority,
+			Facility:  record.facility,
+			Clock:     record.clock,
+			Seq:       uint64(seq), //nolint:gosec
+			Message:   record.message,
+		})
+	})
+}
+
+// StreamMachineLogs streams a Talos service's container logs to the provider.
+func (s *Server) StreamMachineLogs(req *agentpb.StreamMachineLogsRequest, stream agentpb.AgentService_StreamMachineLogsServer) error {
+	s.logger.Info("stream machine logs", zap.String("id", req.GetId()), zap.Int64("resume_after_seq", req.GetResumeAfterSeq()))
+
+	// tailLines=-1 replays the whole log, so the locally assigned seq numbers line up with the
+	// ones a previous stream delivered.
+	logsStream, err := s.talosClient.Logs(stream.Context(), req.GetNamespace(), common.ContainerDriver(req.GetDriver()), req.GetId(), true, -1)
+	if err != nil {
+		return status.Errorf(codes.Internal, "error opening logs stream for %q: %v", req.GetId(), err)
+	}
+
+	var seq int64
+
+	for {
+		data, recvErr := logsStream.Recv()
+		if recvErr != nil {
+			if recvErr == io.EOF { //nolint:errorlint
+				return nil
+			}
+
+			return status.Errorf(codes.Internal, "error reading log line for %q: %v", req.GetId(), recvErr)
+		}
+
+		seq++
+
+		if seq <= req.GetResumeAfterSeq() {
+			continue
+		}
+
+		if err = stream.Send(&agentpb.MachineLogRecord{
+			MachineId: s.machineID,
+			Seq:       seq,
+			Message:   string(bytes.TrimRight(data.GetBytes(), "\n")),
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+// kmsgRecord is a single parsed line of the dmesg stream Talos's Dmesg RPC formats its kmsg
+// records into, see Server.Dmesg in Talos's v1alpha1 API server:
+//
+//	fmt.Sprintf("%s: %7s: [%s]: %s", msg.Facility, msg.Priority, msg.Timestamp.Format(time.RFC3339Nano), msg.Message)
+type kmsgRecord struct {
+	message  string
+	priority uint32
+	facility uint32
+	clock    uint64
+}
+
+// kmsgLinePattern matches Talos's formatted dmesg line: a facility name, a priority name, an
+// RFC3339Nano timestamp in brackets, and the message, e.g.:
+//
+//	kern:    info: [2023-01-02T15:04:05.999999999Z]: Linux version 6.6.0 ...
+var kmsgLinePattern = regexp.MustCompile(`^(\S+):\s+(\S+):\s+\[([^]]+)]:\s(.*)$`)
+
+// forwardKmsgLines reads Talos's formatted dmesg lines off dmesgStream, parses them, and invokes
+// send for each with a locally-assigned sequence number, skipping anything the provider has
+// already seen (seq <= resumeAfterSeq). Talos's Dmesg RPC doesn't expose kmsg's own sequence
+// number - only facility, priority, a timestamp and the message - so, like StreamMachineLogs,
+// this numbers records itself in arrival order rather than trying to recover one from the line.
+func forwardKmsgLines(dmesgStream interface{ Recv() (*common.Data, error) }, resumeAfterSeq int64, send func(seq int64, record *kmsgRecord) error) error {
+	var seq int64
+
+	for {
+		data, err := dmesgStream.Recv()
+		if err != nil {
+			if err == io.EOF { //nolint:errorlint
+				return nil
+			}
+
+			return status.Errorf(codes.Internal, "error reading dmesg line: %v", err)
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(data.GetBytes()))
+
+		for scanner.Scan() {
+			record, ok := parseKmsgLine(scanner.Text())
+			if !ok {
+				continue
+			}
+
+			seq++
+
+			if seq <= resumeAfterSeq {
+				continue
+			}
+
+			if err = send(seq, record); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// syslogSeverityByName maps the severity name Talos's Dmesg RPC prints (go-kmsg's
+// Priority.String()) to the RFC 5424 numeric severity carried by KernelLogRecord.Priority.
+var syslogSeverityByName = map[string]uint32{
+	"emerg":   0,
+	"alert":   1,
+	"crit":    2,
+	"err":     3,
+	"warning": 4,
+	"notice":  5,
+	"info":    6,
+	"debug":   7,
+}
+
+// syslogFacilityByName maps the facility name Talos's Dmesg RPC prints (go-kmsg's
+// Facility.String()) to the RFC 5424 numeric facility carried by KernelLogRecord.Facility. Kernel
+// ring buffer messages are essentially always facility 0 ("kern"), but the map doesn't assume that.
+var syslogFacilityByName = map[string]uint32{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+}
+
+// parseKmsgLine parses a single line of Talos's formatted dmesg output.
+func parseKmsgLine(line string) (*kmsgRecord, bool) {
+	matches := kmsgLinePattern.FindStringSubmatch(line)
+	if matches == nil {
+		return nil, false
+	}
+
+	timestamp, err := time.Parse(time.RFC3339Nano, matches[3])
+	if err != nil {
+		return nil, false
+	}
+
+	return &kmsgRecord{
+		facility: syslogFacilityByName[matches[1]],
+		priority: syslogSeverityByName[matches[2]],
+		clock:    uint64(timestamp.UnixMicro()), //nolint:gosec
+		message:  matches[4],
+	}, true
+}
@@ -12,11 +12,11 @@ import (
 	"fmt"
 	"io"
 
-	"github.com/cosi-project/runtime/pkg/safe"
 	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/siderolabs/talos/pkg/machinery/api/common"
+	machineapi "github.com/siderolabs/talos/pkg/machinery/api/machine"
 	"github.com/siderolabs/talos/pkg/machinery/api/storage"
 	talosclient "github.com/siderolabs/talos/pkg/machinery/client"
-	"github.com/siderolabs/talos/pkg/machinery/resources/block"
 	"go.uber.org/zap"
 	"golang.org/x/sync/singleflight"
 	"google.golang.org/grpc"
@@ -24,13 +24,16 @@ import (
 	"google.golang.org/grpc/status"
 
 	agentpb "github.com/siderolabs/talos-metal-agent/api/agent"
+	"github.com/siderolabs/talos-metal-agent/internal/ipmi"
+	"github.com/siderolabs/talos-metal-agent/pkg/cmdverify"
 )
 
-// IPMIClientFactory is the factory to create IPMI clients.
-type IPMIClientFactory func() (IPMIClient, error)
+// BMCClientFactory is the factory to create BMC clients.
+type BMCClientFactory func() (BMCClient, error)
 
-// IPMIClient represents an IPMI client.
-type IPMIClient interface {
+// BMCClient represents a client to a machine's BMC, regardless of the underlying management
+// protocol (IPMI, Redfish, ...).
+type BMCClient interface {
 	io.Closer
 
 	// UserExists checks if the user exists.
@@ -43,37 +46,86 @@ type IPMIClient interface {
 	GetIPPort() (string, uint16, error)
 }
 
+// NetworkConfigurer is implemented by BMC backends that can push a full BMC LAN network profile
+// in one call. Only the IPMI backend (and the no-op null backend) implements it: Redfish-managed BMCs are expected to already
+// have their network reachable out-of-band, since Redfish itself is only reachable over the LAN
+// it would configure.
+type NetworkConfigurer interface {
+	// EnsureLANConfig applies the given BMC LAN addressing mode, static address and VLAN tag.
+	EnsureLANConfig(cfg ipmi.NetworkConfig) error
+
+	// SetSOLEnabled enables or disables Serial-over-LAN.
+	SetSOLEnabled(enabled bool) error
+
+	// EnsureChannelAccess makes sure the channel the network profile was just applied to is
+	// actually reachable at the privilege level AttemptUserSetup's user needs.
+	EnsureChannelAccess() error
+}
+
 // TalosClient represents a Talos API client.
 type TalosClient interface {
 	Reboot(ctx context.Context, opts ...talosclient.RebootMode) error
 	State() state.State
 	BlockDeviceWipe(ctx context.Context, req *storage.BlockDeviceWipeRequest, callOptions ...grpc.CallOption) error
+	Dmesg(ctx context.Context, follow, tail bool) (machineapi.MachineService_DmesgClient, error)
+	Logs(ctx context.Context, namespace string, driver common.ContainerDriver, id string, follow bool, tailLines int32) (machineapi.MachineService_LogsClient, error)
 }
 
 // Server is the agent service server.
 type Server struct {
 	agentpb.UnimplementedAgentServiceServer
 
-	talosClient       TalosClient
-	ipmiClientFactory IPMIClientFactory
+	talosClient      TalosClient
+	bmcClientFactory BMCClientFactory
+
+	machineID string
 
 	logger *zap.Logger
 
 	sf singleflight.Group
 
+	// testMode short-circuits both BMC access and inventory collection, for the case where power
+	// management is handled by an external API instead of a real or simulated BMC (e.g. the one
+	// served by `talosctl cluster create`). It is a different axis from bmc.BackendNull, which
+	// still goes through the normal BMCClient path but talks to no hardware.
 	testMode bool
+
+	// verifier gates the destructive RPCs (SetPowerManagement, WipeDisks, Reboot) on
+	// cmdverify.Verifier.Check. Until api/agent grows the signature/cert_chain/log_entry fields
+	// CommandEnvelope expects (see the cmdverify package doc), Check is called with an empty
+	// envelope, so it can only ever fail verification, never pass it - in ModeOff that's moot, and
+	// in ModeWarn it surfaces as a log line on every destructive call rather than silently doing
+	// nothing. ModeEnforce stays refused by cmdverify.New until the envelope has real data to check.
+	verifier *cmdverify.Verifier
 }
 
 // NewServer creates a new service server.
-func NewServer(talosClient TalosClient, ipmiClientFactory IPMIClientFactory, testMode bool, logger *zap.Logger) *Server {
+func NewServer(talosClient TalosClient, bmcClientFactory BMCClientFactory, machineID string, testMode bool, verifier *cmdverify.Verifier, logger *zap.Logger) *Server {
 	return &Server{
-		talosClient:       talosClient,
-		ipmiClientFactory: ipmiClientFactory,
-		logger:            logger,
-		testMode:          testMode,
+		talosClient:      talosClient,
+		bmcClientFactory: bmcClientFactory,
+		machineID:        machineID,
+		logger:           logger,
+		testMode:         testMode,
+		verifier:         verifier,
 	}
 }
 
+// checkCommand verifies a destructive command via s.verifier before the handler acts on it. method
+// is the RPC's full method name, req its request message.
+func (s *Server) checkCommand(method string, req marshaler) error {
+	payload, err := req.MarshalVT()
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s request for verification: %w", method, err)
+	}
+
+	if err = s.verifier.Check(method, payload, cmdverify.CommandEnvelope{}, s.logger); err != nil {
+		return status.Errorf(codes.PermissionDenied, "%v", err)
+	}
+
+	return nil
+}
+
 // Hello is an endpoint to check if the service is available.
 func (s *Server) Hello(_ context.Context, _ *agentpb.HelloRequest) (*agentpb.HelloResponse, error) {
 	s.logger.Debug("hello", zap.Bool("test_mode", s.testMode))
@@ -92,21 +144,21 @@ func (s *Server) GetPowerManagement(ctx context.Context, req *agentpb.GetPowerMa
 			}, nil
 		}
 
-		ipmiClient, err := s.ipmiClientFactory()
+		bmcClient, err := s.bmcClientFactory()
 		if err != nil {
-			return nil, status.Errorf(codes.Internal, "error creating ipmi client: %v", err)
+			return nil, status.Errorf(codes.Internal, "error creating bmc client: %v", err)
 		}
 
-		defer ipmiClient.Close() //nolint:errcheck
+		defer bmcClient.Close() //nolint:errcheck
 
-		ip, port, err := ipmiClient.GetIPPort()
+		ip, port, err := bmcClient.GetIPPort()
 		if err != nil {
 			return nil, status.Errorf(codes.Internal, "error getting bmc ip port: %v", err)
 		}
 
 		checkUsername := req.GetIpmi().GetCheckUsername()
 
-		exists, err := ipmiClient.UserExists(checkUsername)
+		exists, err := bmcClient.UserExists(checkUsername)
 		if err != nil {
 			return nil, status.Errorf(codes.Internal, "error checking if user %q exists: %v", checkUsername, err)
 		}
@@ -126,78 +178,83 @@ func (s *Server) SetPowerManagement(ctx context.Context, req *agentpb.SetPowerMa
 	s.logger.Debug("set power management", zap.Bool("test_mode", s.testMode), zap.String("ipmi_username", req.GetIpmi().GetUsername()))
 
 	return runSingleflight[*agentpb.SetPowerManagementResponse](ctx, agentpb.AgentService_SetPowerManagement_FullMethodName, &s.sf, req, func() (*agentpb.SetPowerManagementResponse, error) {
+		if err := s.checkCommand(agentpb.AgentService_SetPowerManagement_FullMethodName, req); err != nil {
+			return nil, err
+		}
+
 		if s.testMode {
 			return &agentpb.SetPowerManagementResponse{}, nil
 		}
 
-		ipmiClient, err := s.ipmiClientFactory()
+		bmcClient, err := s.bmcClientFactory()
 		if err != nil {
-			return nil, fmt.Errorf("error creating ipmi client: %w", err)
+			return nil, fmt.Errorf("error creating bmc client: %w", err)
 		}
 
-		defer ipmiClient.Close() //nolint:errcheck
+		defer bmcClient.Close() //nolint:errcheck
 
-		if err = ipmiClient.AttemptUserSetup(req.GetIpmi().GetUsername(), req.GetIpmi().GetPassword(), s.logger); err != nil {
-			return nil, fmt.Errorf("failed to set up IPMI user: %w", err)
+		if err = bmcClient.AttemptUserSetup(req.GetIpmi().GetUsername(), req.GetIpmi().GetPassword(), s.logger); err != nil {
+			return nil, fmt.Errorf("failed to set up BMC user: %w", err)
+		}
+
+		if network := req.GetIpmi().GetNetwork(); network != nil {
+			if err = s.configureNetwork(bmcClient, network); err != nil {
+				return nil, err
+			}
 		}
 
 		return &agentpb.SetPowerManagementResponse{}, nil
 	})
 }
 
-// Reboot reboots the machine.
-func (s *Server) Reboot(ctx context.Context, req *agentpb.RebootRequest) (*agentpb.RebootResponse, error) {
-	s.logger.Info("reboot")
-
-	return runSingleflight[*agentpb.RebootResponse](ctx, agentpb.AgentService_Reboot_FullMethodName, &s.sf, req, func() (*agentpb.RebootResponse, error) {
-		if err := s.talosClient.Reboot(ctx, talosclient.WithPowerCycle); err != nil {
-			return nil, err
-		}
+// configureNetwork pushes the provider-supplied BMC network profile, if the BMC backend supports
+// it.
+func (s *Server) configureNetwork(bmcClient BMCClient, network *agentpb.SetPowerManagementRequest_IPMI_Network) error {
+	configurer, ok := bmcClient.(NetworkConfigurer)
+	if !ok {
+		return status.Error(codes.Unimplemented, "BMC backend does not support network configuration")
+	}
 
-		return &agentpb.RebootResponse{}, nil
-	})
-}
+	mode := ipmi.NetworkModeDHCP
+	if network.GetMode() == agentpb.SetPowerManagementRequest_IPMI_Network_STATIC {
+		mode = ipmi.NetworkModeStatic
+	}
 
-// WipeDisks wipes the disks.
-func (s *Server) WipeDisks(ctx context.Context, req *agentpb.WipeDisksRequest) (*agentpb.WipeDisksResponse, error) {
-	s.logger.Info("wipe disks", zap.Bool("zeroes", req.Zeroes), zap.Bool("test_mode", s.testMode))
+	if err := configurer.EnsureLANConfig(ipmi.NetworkConfig{
+		Mode:    mode,
+		Address: network.GetAddress(),
+		Netmask: network.GetNetmask(),
+		Gateway: network.GetGateway(),
+		VLANID:  uint16(network.GetVlanId()),
+	}); err != nil {
+		return fmt.Errorf("failed to configure BMC network: %w", err)
+	}
 
-	return runSingleflight[*agentpb.WipeDisksResponse](ctx, agentpb.AgentService_WipeDisks_FullMethodName, &s.sf, req, func() (*agentpb.WipeDisksResponse, error) {
-		method := storage.BlockDeviceWipeDescriptor_FAST
-		if req.Zeroes {
-			method = storage.BlockDeviceWipeDescriptor_ZEROES
-		}
+	if err := configurer.SetSOLEnabled(network.GetSolEnabled()); err != nil {
+		return fmt.Errorf("failed to configure BMC SOL: %w", err)
+	}
 
-		diskList, err := safe.StateListAll[*block.Disk](ctx, s.talosClient.State())
-		if err != nil {
-			return nil, fmt.Errorf("failed to list disks: %w", err)
-		}
+	if err := configurer.EnsureChannelAccess(); err != nil {
+		return fmt.Errorf("failed to configure BMC channel access: %w", err)
+	}
 
-		deviceNames := make([]string, 0, diskList.Len())
-		devices := make([]*storage.BlockDeviceWipeDescriptor, 0, diskList.Len())
+	return nil
+}
 
-		for disk := range diskList.All() {
-			if disk.TypedSpec().Readonly || disk.TypedSpec().CDROM {
-				continue
-			}
+// Reboot reboots the machine.
+func (s *Server) Reboot(ctx context.Context, req *agentpb.RebootRequest) (*agentpb.RebootResponse, error) {
+	s.logger.Info("reboot")
 
-			deviceNames = append(deviceNames, disk.Metadata().ID())
-			devices = append(devices, &storage.BlockDeviceWipeDescriptor{
-				Device:          disk.Metadata().ID(),
-				Method:          method,
-				SkipVolumeCheck: true,
-			})
+	return runSingleflight[*agentpb.RebootResponse](ctx, agentpb.AgentService_Reboot_FullMethodName, &s.sf, req, func() (*agentpb.RebootResponse, error) {
+		if err := s.checkCommand(agentpb.AgentService_Reboot_FullMethodName, req); err != nil {
+			return nil, err
 		}
 
-		s.logger.Debug("going to wipe disks", zap.Strings("devices", deviceNames))
-
-		if err = s.talosClient.BlockDeviceWipe(ctx, &storage.BlockDeviceWipeRequest{
-			Devices: devices,
-		}); err != nil {
-			return nil, fmt.Errorf("failed to wipe disks: %w", err)
+		if err := s.talosClient.Reboot(ctx, talosclient.WithPowerCycle); err != nil {
+			return nil, err
 		}
 
-		return &agentpb.WipeDisksResponse{}, nil
+		return &agentpb.RebootResponse{}, nil
 	})
 }
 
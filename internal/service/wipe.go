@@ -0,0 +1,320 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/siderolabs/talos/pkg/machinery/api/storage"
+	"github.com/siderolabs/talos/pkg/machinery/resources/block"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	agentpb "github.com/siderolabs/talos-metal-agent/api/agent"
+)
+
+// ataSecureErasePassword is the ATA security password the agent sets (and clears by erasing)
+// around a secure erase. Its value doesn't matter, since the drive is power-cycled and its
+// security state reset between uses, but hdparm requires one to be set.
+const ataSecureErasePassword = "SideroMetalWipe"
+
+// errUnsupportedByDevice is returned by a secure erase method when the disk's transport or
+// advertised capabilities don't support it, so the caller can fall back to the Talos wipe path.
+var errUnsupportedByDevice = errors.New("device does not support requested wipe method")
+
+// WipeDisks wipes the disks using the requested method. Methods that talk to the disk's firmware
+// directly (ATA secure erase, NVMe sanitize/format) are attempted first and fall back to the
+// Talos block device wipe path for any disk that doesn't advertise the requested capability.
+func (s *Server) WipeDisks(ctx context.Context, req *agentpb.WipeDisksRequest) (*agentpb.WipeDisksResponse, error) {
+	method := req.GetMethod()
+
+	s.logger.Info("wipe disks", zap.Stringer("method", method), zap.Bool("test_mode", s.testMode))
+
+	return runSingleflight[*agentpb.WipeDisksResponse](ctx, agentpb.AgentService_WipeDisks_FullMethodName, &s.sf, req, func() (*agentpb.WipeDisksResponse, error) {
+		if err := s.checkCommand(agentpb.AgentService_WipeDisks_FullMethodName, req); err != nil {
+			return nil, err
+		}
+
+		diskList, err := safe.StateListAll[*block.Disk](ctx, s.talosClient.State())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list disks: %w", err)
+		}
+
+		results := make([]*agentpb.WipeDisksResponse_DiskResult, 0, diskList.Len())
+
+		var talosDevices []*storage.BlockDeviceWipeDescriptor
+
+		for disk := range diskList.All() {
+			spec := disk.TypedSpec()
+			if spec.Readonly || spec.CDROM {
+				continue
+			}
+
+			id := disk.Metadata().ID()
+
+			if isSecureEraseMethod(method) {
+				start := time.Now()
+
+				eraseErr := s.secureErase(ctx, spec, method)
+
+				switch {
+				case eraseErr == nil:
+					results = append(results, wipeResult(id, method, time.Since(start), nil))
+
+					continue
+				case errors.Is(eraseErr, errUnsupportedByDevice):
+					s.logger.Info("disk doesn't support requested wipe method, falling back to talos wipe",
+						zap.String("device", id), zap.String("transport", spec.Transport), zap.Stringer("method", method))
+				default:
+					results = append(results, wipeResult(id, method, time.Since(start), eraseErr))
+
+					continue
+				}
+			}
+
+			talosDevices = append(talosDevices, &storage.BlockDeviceWipeDescriptor{
+				Device:          id,
+				Method:          talosFallbackMethod(method),
+				SkipVolumeCheck: true,
+			})
+		}
+
+		if len(talosDevices) > 0 {
+			start := time.Now()
+			wipeErr := s.talosClient.BlockDeviceWipe(ctx, &storage.BlockDeviceWipeRequest{Devices: talosDevices})
+			elapsed := time.Since(start)
+
+			if wipeErr != nil {
+				wipeErr = fmt.Errorf("failed to wipe disks: %w", wipeErr)
+			}
+
+			for _, device := range talosDevices {
+				results = append(results, wipeResult(device.Device, method, elapsed, wipeErr))
+			}
+		}
+
+		return &agentpb.WipeDisksResponse{Results: results}, nil
+	})
+}
+
+// isSecureEraseMethod reports whether method needs to talk to the disk's firmware directly, as
+// opposed to the plain FAST/ZEROES methods that the Talos block device wipe path already handles.
+func isSecureEraseMethod(method agentpb.WipeDisksRequest_Method) bool {
+	switch method {
+	case agentpb.WipeDisksRequest_ATA_SECURE_ERASE, agentpb.WipeDisksRequest_ATA_ENHANCED_SECURE_ERASE,
+		agentpb.WipeDisksRequest_NVME_FORMAT_CRYPTO_ERASE, agentpb.WipeDisksRequest_NVME_SANITIZE_BLOCK, agentpb.WipeDisksRequest_NVME_SANITIZE_CRYPTO:
+		return true
+	default:
+		return false
+	}
+}
+
+// talosFallbackMethod maps a wipe method to the Talos block device wipe method used as a
+// fallback, or directly for FAST/ZEROES, which the Talos wipe path already implements.
+func talosFallbackMethod(method agentpb.WipeDisksRequest_Method) storage.BlockDeviceWipeDescriptor_Method {
+	if method == agentpb.WipeDisksRequest_ZEROES {
+		return storage.BlockDeviceWipeDescriptor_ZEROES
+	}
+
+	return storage.BlockDeviceWipeDescriptor_FAST
+}
+
+// wipeResult builds the per-disk result record reported back to the provider.
+func wipeResult(device string, method agentpb.WipeDisksRequest_Method, elapsed time.Duration, err error) *agentpb.WipeDisksResponse_DiskResult {
+	result := &agentpb.WipeDisksResponse_DiskResult{
+		Device:  device,
+		Method:  method,
+		Success: err == nil,
+		Elapsed: durationpb.New(elapsed),
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// secureErase dispatches a secure erase method to the ATA or NVMe implementation, rejecting
+// methods that don't match the disk's transport.
+func (s *Server) secureErase(ctx context.Context, spec *block.DiskSpec, method agentpb.WipeDisksRequest_Method) error {
+	switch method {
+	case agentpb.WipeDisksRequest_ATA_SECURE_ERASE, agentpb.WipeDisksRequest_ATA_ENHANCED_SECURE_ERASE:
+		if spec.Transport != "ata" && spec.Transport != "sata" {
+			return errUnsupportedByDevice
+		}
+
+		return ataSecureErase(ctx, spec.DevPath, method == agentpb.WipeDisksRequest_ATA_ENHANCED_SECURE_ERASE)
+	case agentpb.WipeDisksRequest_NVME_FORMAT_CRYPTO_ERASE:
+		if spec.Transport != "nvme" {
+			return errUnsupportedByDevice
+		}
+
+		return nvmeFormatCryptoErase(ctx, spec.DevPath)
+	case agentpb.WipeDisksRequest_NVME_SANITIZE_BLOCK, agentpb.WipeDisksRequest_NVME_SANITIZE_CRYPTO:
+		if spec.Transport != "nvme" {
+			return errUnsupportedByDevice
+		}
+
+		return nvmeSanitize(ctx, spec.DevPath, method == agentpb.WipeDisksRequest_NVME_SANITIZE_CRYPTO)
+	default:
+		return fmt.Errorf("%s is not a secure erase method", method)
+	}
+}
+
+// ataSecureErase issues an ATA Security Erase (or, if enhanced is set, Security Erase Enhanced)
+// against devPath, after checking that the drive advertises support for it and isn't security
+// frozen (a BIOS/firmware lock that requires a power cycle to clear).
+func ataSecureErase(ctx context.Context, devPath string, enhanced bool) error {
+	info, err := runCommand(ctx, "hdparm", "-I", devPath)
+	if err != nil {
+		return fmt.Errorf("failed to query ATA security info for %s: %w", devPath, err)
+	}
+
+	supported, frozen, enhancedSupported := parseHdparmSecurity(info)
+
+	switch {
+	case !supported:
+		return errUnsupportedByDevice
+	case enhanced && !enhancedSupported:
+		return errUnsupportedByDevice
+	case frozen:
+		return fmt.Errorf("%s: ATA security is frozen, a power cycle is required before it can be erased", devPath)
+	}
+
+	if _, err = runCommand(ctx, "hdparm", "--user-master", "u", "--security-set-pass", ataSecureErasePassword, devPath); err != nil {
+		return fmt.Errorf("failed to set ATA security password on %s: %w", devPath, err)
+	}
+
+	eraseFlag := "--security-erase"
+	if enhanced {
+		eraseFlag = "--security-erase-enhanced"
+	}
+
+	if _, err = runCommand(ctx, "hdparm", "--user-master", "u", eraseFlag, ataSecureErasePassword, devPath); err != nil {
+		return fmt.Errorf("failed to issue ATA secure erase on %s: %w", devPath, err)
+	}
+
+	return nil
+}
+
+// parseHdparmSecurity best-effort parses the ATA Security feature set block out of `hdparm -I`
+// output, e.g.:
+//
+//	Security:
+//		Master password revision code = 65534
+//			supported
+//		not	enabled
+//		not	locked
+//		not	frozen
+//		not	expired: security count
+//			supported: enhanced erase
+func parseHdparmSecurity(output string) (supported, frozen, enhancedEraseSupported bool) {
+	supported = strings.Contains(output, "\tsupported\n") && !strings.Contains(output, "not\tsupported\n")
+	frozen = strings.Contains(output, "\tfrozen\n") && !strings.Contains(output, "not\tfrozen\n")
+	enhancedEraseSupported = strings.Contains(output, "supported: enhanced erase")
+
+	return supported, frozen, enhancedEraseSupported
+}
+
+// NVMe Sanitize Capabilities (SANICAP) and Format NVM Attributes (FNA) bits, as defined by the
+// NVMe base specification's Identify Controller data structure.
+const (
+	nvmeSanicapCryptoErase = 1 << 0
+	nvmeSanicapBlockErase  = 1 << 1
+	nvmeFnaCryptoErase     = 1 << 2
+)
+
+// nvmeIdentifyController is the subset of `nvme id-ctrl`'s JSON output this package cares about.
+type nvmeIdentifyController struct {
+	Sanicap uint32 `json:"sanicap"`
+	Fna     uint32 `json:"fna"`
+}
+
+// nvmeFormatCryptoErase issues an NVMe Format with a cryptographic erase secure erase setting
+// against devPath, after checking that the controller advertises support for it.
+func nvmeFormatCryptoErase(ctx context.Context, devPath string) error {
+	ctrl, err := nvmeIdentify(ctx, devPath)
+	if err != nil {
+		return err
+	}
+
+	if ctrl.Fna&nvmeFnaCryptoErase == 0 {
+		return errUnsupportedByDevice
+	}
+
+	if _, err = runCommand(ctx, "nvme", "format", devPath, "--ses=2"); err != nil {
+		return fmt.Errorf("failed to issue NVMe format crypto erase on %s: %w", devPath, err)
+	}
+
+	return nil
+}
+
+// nvmeSanitize issues an NVMe Sanitize block erase (or, if crypto is set, crypto erase) against
+// devPath, after checking that the controller advertises support for it.
+func nvmeSanitize(ctx context.Context, devPath string, crypto bool) error {
+	ctrl, err := nvmeIdentify(ctx, devPath)
+	if err != nil {
+		return err
+	}
+
+	sanact := "2" // Block Erase
+
+	switch {
+	case crypto && ctrl.Sanicap&nvmeSanicapCryptoErase != 0:
+		sanact = "4" // Crypto Erase
+	case crypto:
+		return errUnsupportedByDevice
+	case ctrl.Sanicap&nvmeSanicapBlockErase == 0:
+		return errUnsupportedByDevice
+	}
+
+	if _, err = runCommand(ctx, "nvme", "sanitize", devPath, "--sanact="+sanact); err != nil {
+		return fmt.Errorf("failed to issue NVMe sanitize on %s: %w", devPath, err)
+	}
+
+	return nil
+}
+
+// nvmeIdentify runs `nvme id-ctrl` against devPath and parses the capability bits out of its
+// JSON output.
+func nvmeIdentify(ctx context.Context, devPath string) (nvmeIdentifyController, error) {
+	out, err := runCommand(ctx, "nvme", "id-ctrl", devPath, "-o", "json")
+	if err != nil {
+		return nvmeIdentifyController{}, fmt.Errorf("failed to query NVMe controller identify for %s: %w", devPath, err)
+	}
+
+	var ctrl nvmeIdentifyController
+
+	if err = json.Unmarshal([]byte(out), &ctrl); err != nil {
+		return nvmeIdentifyController{}, fmt.Errorf("failed to parse NVMe controller identify for %s: %w", devPath, err)
+	}
+
+	return ctrl, nil
+}
+
+// runCommand runs name with args, returning its combined stdout/stderr output.
+func runCommand(ctx context.Context, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+
+	var output bytes.Buffer
+
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(output.String()))
+	}
+
+	return output.String(), nil
+}
@@ -0,0 +1,257 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package tunnel supervises the agent's reverse grpctunnel connection to the infra provider.
+//
+// It dials each configured provider address in order, health-probing the grpc connection before
+// serving the reverse tunnel over it, retries with exponential backoff once every candidate has
+// been tried, and when an active tunnel breaks goes through the addresses again from the first
+// one, failing over to the next whenever one is unreachable. On shutdown it
+// drains in-flight RPCs (IPMI calls, disk wipes, ...) using a bounded-timeout context instead of
+// tearing the stream down with the caller's context, and it keeps a short rolling log of
+// connection events - along with the currently active provider - available through Status for
+// local debugging.
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/jhump/grpctunnel"
+	"github.com/jhump/grpctunnel/tunnelpb"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// maxEvents is the number of connection events Status retains.
+const maxEvents = 20
+
+// defaultDrainTimeout is how long Run lets in-flight RPCs finish on their own once ctx is
+// cancelled, before forcing the tunnel closed.
+const defaultDrainTimeout = 30 * time.Second
+
+// Event is a single connection event recorded for Status.
+type Event struct {
+	Time    time.Time
+	Address string
+	Message string
+}
+
+// Status is a snapshot of the supervisor's current connection state, for local debugging.
+type Status struct {
+	// ActiveAddress is the provider address the tunnel is currently served over, or empty if no
+	// tunnel is currently up.
+	ActiveAddress string
+
+	// Events are the most recent connection events, oldest first.
+	Events []Event
+}
+
+// Supervisor maintains a reverse grpctunnel connection to one of several candidate provider
+// addresses, registering register's services over whichever tunnel is currently active.
+type Supervisor struct {
+	addresses    []string
+	dialOptions  []grpc.DialOption
+	register     func(*grpctunnel.ReverseTunnelServer)
+	drainTimeout time.Duration
+	logger       *zap.Logger
+
+	mu     sync.Mutex
+	active string
+	events []Event
+}
+
+// NewSupervisor creates a Supervisor that dials addresses - tried in order - with dialOptions,
+// and calls register on the reverse tunnel server for each tunnel it serves so the caller can
+// register its grpc services on it.
+func NewSupervisor(addresses []string, dialOptions []grpc.DialOption, register func(*grpctunnel.ReverseTunnelServer), logger *zap.Logger) *Supervisor {
+	return &Supervisor{
+		addresses:    addresses,
+		dialOptions:  dialOptions,
+		register:     register,
+		drainTimeout: defaultDrainTimeout,
+		logger:       logger,
+	}
+}
+
+// Run serves the reverse tunnel, failing over between the supervisor's addresses until ctx is
+// cancelled. While every address is unreachable it retries with exponential backoff; once a
+// tunnel has been successfully established, the backoff resets and the next attempt (should the
+// tunnel later break) starts again from the first address. On cancellation it drains in-flight
+// RPCs for up to the supervisor's drain timeout before tearing the active tunnel down, then
+// returns nil.
+func (s *Supervisor) Run(ctx context.Context) error {
+	if len(s.addresses) == 0 {
+		return fmt.Errorf("no provider addresses configured")
+	}
+
+	bo := backoff.NewExponentialBackOff()
+	bo.MaxElapsedTime = 0
+
+	for i := 0; ; i++ {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		address := s.addresses[i%len(s.addresses)]
+
+		established, err := s.serveOnce(ctx, address)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if established {
+			bo.Reset()
+			i = -1
+
+			continue
+		}
+
+		if (i+1)%len(s.addresses) != 0 {
+			s.recordEvent(address, fmt.Sprintf("failed to connect: %v (trying next address)", err))
+			s.logger.Warn("failed to connect to provider, trying next address", zap.String("address", address), zap.Error(err))
+
+			continue
+		}
+
+		wait := bo.NextBackOff()
+
+		s.recordEvent(address, fmt.Sprintf("failed to connect: %v (retrying in %s)", err, wait))
+		s.logger.Warn("failed to connect to provider", zap.String("address", address), zap.Duration("retry_in", wait), zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Status returns a snapshot of the supervisor's current connection state.
+func (s *Supervisor) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return Status{
+		ActiveAddress: s.active,
+		Events:        append([]Event(nil), s.events...),
+	}
+}
+
+// serveOnce dials address, health-probes the connection, and - if it comes up - serves the
+// reverse tunnel over it until ctx is cancelled or the tunnel breaks. established reports whether
+// the tunnel was ever successfully served, so Run can tell a health-probe failure (move on to the
+// next address immediately) apart from a tunnel that ran for a while before breaking (worth
+// resetting the backoff for).
+func (s *Supervisor) serveOnce(ctx context.Context, address string) (established bool, err error) {
+	conn, err := grpc.NewClient(address, s.dialOptions...)
+	if err != nil {
+		return false, fmt.Errorf("failed to create grpc client: %w", err)
+	}
+	defer conn.Close() //nolint:errcheck
+
+	if err = waitForReady(ctx, conn); err != nil {
+		return false, err
+	}
+
+	s.setActive(address)
+	defer s.setActive("")
+
+	s.recordEvent(address, "connected")
+	s.logger.Info("connected to provider", zap.String("address", address))
+
+	tunnelStub := tunnelpb.NewTunnelServiceClient(conn)
+	channelServer := grpctunnel.NewReverseTunnelServer(tunnelStub)
+	s.register(channelServer)
+
+	// The tunnel stream is served over its own context, decoupled from ctx, so that on
+	// cancellation we can drain in-flight RPCs on our own schedule instead of having grpctunnel
+	// tear the stream down the instant ctx is cancelled.
+	streamCtx, cancelStream := context.WithCancel(context.Background())
+	defer cancelStream()
+
+	serveErrCh := make(chan error, 1)
+
+	go func() {
+		_, serveErr := channelServer.Serve(streamCtx)
+		serveErrCh <- serveErr
+	}()
+
+	select {
+	case <-ctx.Done():
+		s.drain(channelServer)
+
+		return true, nil
+	case err = <-serveErrCh:
+	}
+
+	if err != nil {
+		s.recordEvent(address, fmt.Sprintf("connection lost: %v", err))
+		s.logger.Warn("tunnel connection to provider lost, failing over", zap.String("address", address), zap.Error(err))
+	}
+
+	return true, err
+}
+
+// drain gives in-flight RPCs up to the supervisor's drain timeout to finish on their own via
+// GracefulStop, then forces the tunnel closed if the timeout is exceeded.
+func (s *Supervisor) drain(channelServer *grpctunnel.ReverseTunnelServer) {
+	done := make(chan struct{})
+
+	go func() {
+		channelServer.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(s.drainTimeout):
+		s.logger.Warn("drain timeout exceeded, forcing tunnel closed", zap.Duration("timeout", s.drainTimeout))
+		channelServer.Stop()
+		<-done
+	}
+}
+
+// waitForReady blocks until conn reaches connectivity.Ready, returning an error if the connection
+// attempt fails (connectivity.TransientFailure) or ctx is cancelled.
+func waitForReady(ctx context.Context, conn *grpc.ClientConn) error {
+	conn.Connect()
+
+	for {
+		state := conn.GetState()
+
+		switch state { //nolint:exhaustive
+		case connectivity.Ready:
+			return nil
+		case connectivity.TransientFailure:
+			return fmt.Errorf("health probe failed: connection is in state %s", state)
+		}
+
+		if !conn.WaitForStateChange(ctx, state) {
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *Supervisor) setActive(address string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.active = address
+}
+
+func (s *Supervisor) recordEvent(address, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, Event{Time: time.Now(), Address: address, Message: message})
+
+	if len(s.events) > maxEvents {
+		s.events = s.events[len(s.events)-maxEvents:]
+	}
+}
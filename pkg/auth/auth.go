@@ -0,0 +1,267 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package auth implements siderov1-style request signing for the gRPC connection between the
+// agent and the metal provider, built on top of github.com/siderolabs/go-api-signature's signing
+// primitives. It is imported by both ends of the tunnel: the agent signs outgoing calls, and the
+// provider verifies them.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/siderolabs/go-api-signature/pkg/message"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/siderolabs/talos-metal-agent/pkg/constants"
+)
+
+// Signer signs outgoing agent requests. A *pgp.Key loaded via LoadOrGenerateKey satisfies this.
+type Signer = message.Signer
+
+// Verifier verifies the signature on an incoming request against a registered public key. A
+// public-key-only *pgp.Key satisfies this.
+type Verifier = message.SignatureVerifier
+
+// VerifierLookup resolves the machine ID presented by an incoming request to the public key
+// registered for it, e.g. against the provider's ServerHardware resources. It should return an
+// error if the machine ID is unknown.
+type VerifierLookup func(machineID string) (Verifier, error)
+
+const (
+	// TimestampMetadataKey carries the Unix timestamp the request was signed at.
+	TimestampMetadataKey = "x-sidero-timestamp"
+
+	// SignatureMetadataKey carries the siderov1 signature of the request, in the form
+	// "siderov1 <machine-id> <key-fingerprint> <base64 signature>".
+	SignatureMetadataKey = "x-sidero-signature"
+
+	// BodyHashMetadataKey carries the hex-encoded SHA-256 hash of the request body.
+	BodyHashMetadataKey = "x-sidero-body-hash"
+
+	signatureVersion = "siderov1"
+
+	// allowedClockSkew is how far a request's timestamp may drift from the verifier's clock
+	// before it's rejected, bounding how long a captured signature can be replayed.
+	allowedClockSkew = 5 * time.Minute
+)
+
+// marshaler is implemented by every generated agent protobuf request message.
+type marshaler interface {
+	MarshalVT() ([]byte, error)
+}
+
+// UnaryClientInterceptor signs outgoing unary calls, binding the method, identity (the agent's
+// machine ID), timestamp and request body hash into the signature.
+func UnaryClientInterceptor(identity string, signer Signer) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, err := sign(ctx, identity, signer, method, req)
+		if err != nil {
+			return fmt.Errorf("failed to sign request: %w", err)
+		}
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor signs outgoing streaming calls. Streaming requests have no single body
+// to hash, so only the method, identity and timestamp are bound into the signature.
+func StreamClientInterceptor(identity string, signer Signer) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, err := sign(ctx, identity, signer, method, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign request: %w", err)
+		}
+
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// UnaryServerInterceptor verifies the siderov1 signature on incoming unary calls, looking up the
+// verifying key for the claimed machine ID via lookup.
+func UnaryServerInterceptor(lookup VerifierLookup) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := verify(ctx, lookup, info.FullMethod, req); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor verifies the siderov1 signature on incoming streaming calls.
+func StreamServerInterceptor(lookup VerifierLookup) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := verify(ss.Context(), lookup, info.FullMethod, nil); err != nil {
+			return err
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+// sign attaches the timestamp, body hash and siderov1 signature headers to the outgoing call's
+// metadata.
+func sign(ctx context.Context, identity string, signer Signer, method string, req any) (context.Context, error) {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.New(nil)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	bodyHash, err := hashBody(req)
+	if err != nil {
+		return ctx, err
+	}
+
+	signature, err := signer.Sign(signedPayload(method, identity, timestamp, bodyHash))
+	if err != nil {
+		return ctx, fmt.Errorf("failed to sign payload: %w", err)
+	}
+
+	md.Set(TimestampMetadataKey, timestamp)
+	md.Set(BodyHashMetadataKey, bodyHash)
+	md.Set(SignatureMetadataKey, fmt.Sprintf("%s %s %s %s", signatureVersion, identity, signer.Fingerprint(), base64.StdEncoding.EncodeToString(signature)))
+
+	return metadata.NewOutgoingContext(ctx, md), nil
+}
+
+// verify checks the timestamp, body hash and siderov1 signature headers on an incoming call.
+func verify(ctx context.Context, lookup VerifierLookup, method string, req any) error {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "missing request metadata")
+	}
+
+	identity := firstValue(md, constants.MachineIDMetadataKey)
+	if identity == "" {
+		return status.Errorf(codes.Unauthenticated, "missing %s header", constants.MachineIDMetadataKey)
+	}
+
+	timestamp := firstValue(md, TimestampMetadataKey)
+	if timestamp == "" {
+		return status.Errorf(codes.Unauthenticated, "missing %s header", TimestampMetadataKey)
+	}
+
+	if err := verifyTimestamp(timestamp); err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	signerIdentity, fingerprint, signature, err := parseSignatureHeader(firstValue(md, SignatureMetadataKey))
+	if err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	if signerIdentity != identity {
+		return status.Error(codes.Unauthenticated, "signature identity does not match machine ID header")
+	}
+
+	verifier, err := lookup(identity)
+	if err != nil {
+		return status.Errorf(codes.Unauthenticated, "unknown signer %q: %v", identity, err)
+	}
+
+	bodyHash := firstValue(md, BodyHashMetadataKey)
+
+	if req != nil {
+		expectedHash, hashErr := hashBody(req)
+		if hashErr != nil {
+			return status.Error(codes.Internal, hashErr.Error())
+		}
+
+		if expectedHash != bodyHash {
+			return status.Error(codes.Unauthenticated, "request body hash does not match signed hash")
+		}
+	}
+
+	if err = verifier.Verify(signedPayload(method, identity, timestamp, bodyHash), signature); err != nil {
+		return status.Errorf(codes.Unauthenticated, "signature verification failed for fingerprint %s: %v", fingerprint, err)
+	}
+
+	return nil
+}
+
+// signedPayload builds the canonical byte sequence that gets signed: the call's method, the
+// signer's claimed identity (the agent's machine ID), the timestamp and the request body hash.
+// Binding all four prevents a captured signature from being replayed against a different call, a
+// different machine identity, outside its time window, or with a tampered body.
+func signedPayload(method, identity, timestamp, bodyHash string) []byte {
+	return []byte(strings.Join([]string{method, identity, timestamp, bodyHash}, "\n"))
+}
+
+func hashBody(req any) (string, error) {
+	m, ok := req.(marshaler)
+	if !ok {
+		return "", nil
+	}
+
+	b, err := m.MarshalVT()
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func parseSignatureHeader(value string) (identity string, fingerprint string, signature []byte, err error) {
+	if value == "" {
+		return "", "", nil, fmt.Errorf("missing %s header", SignatureMetadataKey)
+	}
+
+	parts := strings.Fields(value)
+	if len(parts) != 4 {
+		return "", "", nil, fmt.Errorf("malformed %s header", SignatureMetadataKey)
+	}
+
+	if parts[0] != signatureVersion {
+		return "", "", nil, fmt.Errorf("unsupported signature version %q", parts[0])
+	}
+
+	signature, err = base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return "", "", nil, fmt.Errorf("malformed signature: %w", err)
+	}
+
+	return parts[1], parts[2], signature, nil
+}
+
+func verifyTimestamp(value string) error {
+	unix, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("malformed %s header", TimestampMetadataKey)
+	}
+
+	timestamp := time.Unix(unix, 0)
+	now := time.Now()
+
+	if timestamp.Before(now.Add(-allowedClockSkew)) || timestamp.After(now.Add(allowedClockSkew)) {
+		return fmt.Errorf("timestamp %s is outside the allowed clock skew", timestamp)
+	}
+
+	return nil
+}
+
+func firstValue(md metadata.MD, key string) string {
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
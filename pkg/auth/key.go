@@ -0,0 +1,74 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	pgpcrypto "github.com/ProtonMail/gopenpgp/v2/crypto"
+
+	"github.com/siderolabs/go-api-signature/pkg/pgp"
+)
+
+// keyLifetime is how long a generated signing key is valid for. Unlike the short-lived,
+// human-facing keys go-api-signature's own CLI client generates, the agent has no one present to
+// refresh an expired key at boot, so it gets a long-lived one instead.
+const keyLifetime = 10 * 365 * 24 * time.Hour
+
+// LoadOrGenerateKey loads the agent's long-lived PGP signing keypair from keyPath, generating and
+// persisting a new one there if it doesn't exist yet. identity (the agent's machine ID) is
+// embedded in the key as its PGP identity.
+func LoadOrGenerateKey(keyPath, identity string) (*pgp.Key, error) {
+	armored, err := os.ReadFile(keyPath)
+
+	switch {
+	case err == nil:
+		return parseArmoredKey(armored)
+	case errors.Is(err, os.ErrNotExist):
+		return generateKey(keyPath, identity)
+	default:
+		return nil, fmt.Errorf("failed to read signing key %q: %w", keyPath, err)
+	}
+}
+
+func generateKey(keyPath, identity string) (*pgp.Key, error) {
+	key, err := pgp.GenerateKey(identity, "talos-metal-agent", identity, keyLifetime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	armored, err := key.Armor()
+	if err != nil {
+		return nil, fmt.Errorf("failed to armor generated signing key: %w", err)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(keyPath), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create signing key directory: %w", err)
+	}
+
+	if err = os.WriteFile(keyPath, []byte(armored), 0o600); err != nil {
+		return nil, fmt.Errorf("failed to persist signing key %q: %w", keyPath, err)
+	}
+
+	return key, nil
+}
+
+func parseArmoredKey(armored []byte) (*pgp.Key, error) {
+	parsed, err := pgpcrypto.NewKeyFromArmored(string(armored))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+
+	key, err := pgp.NewKey(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing key: %w", err)
+	}
+
+	return key, nil
+}
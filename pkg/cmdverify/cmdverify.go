@@ -0,0 +1,338 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package cmdverify verifies that a destructive command (power control, disk wipe, reboot) the
+// provider sends over the grpctunnel is backed by both a signature chaining to a configured trust
+// root and an inclusion proof in a configured transparency log, inspired by how
+// sigstore/slsa-verifier ties artifact signatures to Rekor. This guards against a compromised or
+// rogue provider issuing unlogged destructive orders: every command the log hasn't witnessed is
+// rejected (or, in Warn mode, merely flagged) before the agent acts on it.
+//
+// CommandEnvelope mirrors the signature, cert_chain and log_entry fields this package expects the
+// command protobufs to carry. Those fields don't exist yet: they belong on api/agent, this
+// module's own generated agent gRPC package, which hasn't grown them yet. service.Server's
+// destructive handlers (SetPowerManagement, WipeDisks, Reboot) already call Verifier.Check, but
+// until that field addition lands they can only pass an empty CommandEnvelope, which always fails
+// verification. New refuses ModeEnforce so that can't turn into "every destructive command is
+// rejected"; in ModeWarn it instead turns into a log line on every destructive call, which is the
+// honest signal that real verification isn't wired up yet.
+package cmdverify
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Mode selects how strictly Verifier.Check enforces a failed or missing verification.
+type Mode string
+
+const (
+	// ModeOff disables verification entirely; Check always succeeds.
+	ModeOff Mode = "off"
+
+	// ModeWarn runs verification and logs a failure, but still lets the command through. Intended
+	// for rolling out verification against a fleet of providers that don't sign/log commands yet.
+	ModeWarn Mode = "warn"
+
+	// ModeEnforce rejects any command that fails verification. Not currently accepted by New: see
+	// the package doc for why.
+	ModeEnforce Mode = "enforce"
+)
+
+// CommandEnvelope carries the signature, certificate chain and transparency log inclusion proof a
+// destructive command is expected to carry once the command protobufs grow these fields.
+type CommandEnvelope struct {
+	// Signature is the detached signature of the command payload, made with the leaf
+	// certificate's private key.
+	Signature []byte
+
+	// CertChain is the PEM-encoded leaf certificate, followed by any intermediates, chaining up
+	// to the configured trust root.
+	CertChain []byte
+
+	// LogEntry is the transparency log inclusion proof for the signed command.
+	LogEntry LogEntry
+}
+
+// LogEntry is a Merkle inclusion proof for a leaf in the transparency log, plus the signed
+// checkpoint (tree head) it's proven against.
+type LogEntry struct {
+	// LeafHash is the RFC 6962 leaf hash of the logged entry (the signature and cert chain
+	// above).
+	LeafHash []byte
+
+	// Index is the leaf's index in the log.
+	Index uint64
+
+	// InclusionHashes are the sibling hashes of the Merkle audit path from the leaf to the root,
+	// ordered leaf-to-root.
+	InclusionHashes [][]byte
+
+	// Checkpoint is the signed tree head the inclusion proof is checked against.
+	Checkpoint Checkpoint
+}
+
+// Checkpoint is a signed transparency log tree head.
+type Checkpoint struct {
+	// Origin identifies the log, e.g. its configured URL.
+	Origin string
+
+	// Size is the number of leaves in the tree the checkpoint commits to.
+	Size uint64
+
+	// RootHash is the Merkle root hash of the tree at Size.
+	RootHash []byte
+
+	// Signature is the log operator's signature over the checkpoint's canonical encoding.
+	Signature []byte
+}
+
+// Verifier checks commands against a configured trust root and transparency log public key.
+type Verifier struct {
+	mode         Mode
+	trustRoots   *x509.CertPool
+	logPublicKey ed25519.PublicKey
+	logOrigin    string
+}
+
+// New creates a Verifier. trustRootsPEM is a PEM bundle of one or more root CA certificates
+// commands' certificate chains must chain up to. logPublicKey is the transparency log's Ed25519
+// checkpoint-signing key. logOrigin is the log identity expected in checkpoints, e.g. its
+// configured URL.
+func New(mode Mode, trustRootsPEM []byte, logPublicKey ed25519.PublicKey, logOrigin string) (*Verifier, error) {
+	if mode == ModeEnforce {
+		return nil, fmt.Errorf("verify mode %q is not supported: the command handlers can only hand Check an empty envelope, "+
+			"so enforcing it would reject every command - use %q or %q instead", mode, ModeOff, ModeWarn)
+	}
+
+	pool := x509.NewCertPool()
+
+	if mode != ModeOff {
+		if !pool.AppendCertsFromPEM(trustRootsPEM) {
+			return nil, fmt.Errorf("no valid root certificates found in trust root bundle")
+		}
+	}
+
+	return &Verifier{
+		mode:         mode,
+		trustRoots:   pool,
+		logPublicKey: logPublicKey,
+		logOrigin:    logOrigin,
+	}, nil
+}
+
+// Check verifies that envelope signs payload with a certificate chaining to the configured trust
+// root, and that the signed entry is included in the transparency log per its checkpoint. method
+// identifies the command RPC, for logging only.
+//
+// In ModeOff, Check always returns nil. In ModeWarn, a failure is logged and nil is returned
+// regardless. In ModeEnforce, a failure is returned as an error and the caller must not act on the
+// command.
+func (v *Verifier) Check(method string, payload []byte, envelope CommandEnvelope, logger *zap.Logger) error {
+	if v.mode == ModeOff {
+		return nil
+	}
+
+	err := v.verify(payload, envelope)
+	if err == nil {
+		return nil
+	}
+
+	if v.mode == ModeWarn {
+		logger.Warn("command verification failed, proceeding because verify mode is warn",
+			zap.String("method", method), zap.Error(err))
+
+		return nil
+	}
+
+	return fmt.Errorf("command verification failed for %s: %w", method, err)
+}
+
+func (v *Verifier) verify(payload []byte, envelope CommandEnvelope) error {
+	leaf, err := v.verifyCertChain(envelope.CertChain)
+	if err != nil {
+		return fmt.Errorf("certificate chain verification failed: %w", err)
+	}
+
+	if err = verifySignature(leaf, payload, envelope.Signature); err != nil {
+		return fmt.Errorf("signature verification failed: %w", err)
+	}
+
+	leafHash := leafHash(envelope.CertChain, envelope.Signature)
+	if !bytes.Equal(leafHash, envelope.LogEntry.LeafHash) {
+		return fmt.Errorf("log entry does not cover this command's signature")
+	}
+
+	if err = v.verifyCheckpoint(envelope.LogEntry.Checkpoint); err != nil {
+		return fmt.Errorf("checkpoint verification failed: %w", err)
+	}
+
+	if err = verifyInclusion(leafHash, envelope.LogEntry.Index, envelope.LogEntry.InclusionHashes,
+		envelope.LogEntry.Checkpoint.Size, envelope.LogEntry.Checkpoint.RootHash); err != nil {
+		return fmt.Errorf("inclusion proof verification failed: %w", err)
+	}
+
+	return nil
+}
+
+// verifyCertChain verifies that the PEM-encoded chain in chainPEM - a leaf certificate followed by
+// zero or more intermediates - chains up to the configured trust root, and returns the leaf.
+func (v *Verifier) verifyCertChain(chainPEM []byte) (*x509.Certificate, error) {
+	var leaf *x509.Certificate
+
+	intermediates := x509.NewCertPool()
+
+	for rest := chainPEM; ; {
+		var block *pem.Block
+
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+
+		if leaf == nil {
+			leaf = cert
+		} else {
+			intermediates.AddCert(cert)
+		}
+	}
+
+	if leaf == nil {
+		return nil, fmt.Errorf("certificate chain is empty")
+	}
+
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         v.trustRoots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return nil, err
+	}
+
+	return leaf, nil
+}
+
+// verifySignature verifies signature over payload using leaf's public key. Only Ed25519 and ECDSA
+// leaf keys are supported, matching the Fulcio-issued short-lived certificates this is modeled on.
+// ECDSA signatures are ASN.1-encoded and made over the SHA-256 digest of payload.
+func verifySignature(leaf *x509.Certificate, payload, signature []byte) error {
+	switch pub := leaf.PublicKey.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, payload, signature) {
+			return fmt.Errorf("invalid signature")
+		}
+
+		return nil
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(payload)
+
+		if !ecdsa.VerifyASN1(pub, digest[:], signature) {
+			return fmt.Errorf("invalid signature")
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unsupported leaf certificate key type %T", pub)
+	}
+}
+
+// verifyCheckpoint verifies the log operator's signature over the checkpoint and that it
+// identifies the configured log.
+func (v *Verifier) verifyCheckpoint(checkpoint Checkpoint) error {
+	if checkpoint.Origin != v.logOrigin {
+		return fmt.Errorf("checkpoint origin %q does not match configured log %q", checkpoint.Origin, v.logOrigin)
+	}
+
+	if !ed25519.Verify(v.logPublicKey, checkpointBody(checkpoint), checkpoint.Signature) {
+		return fmt.Errorf("invalid checkpoint signature")
+	}
+
+	return nil
+}
+
+// checkpointBody is the canonical byte sequence a checkpoint signature is made over.
+func checkpointBody(checkpoint Checkpoint) []byte {
+	return []byte(strings.Join([]string{
+		checkpoint.Origin,
+		strconv.FormatUint(checkpoint.Size, 10),
+		fmt.Sprintf("%x", checkpoint.RootHash),
+	}, "\n"))
+}
+
+// leafHash computes the RFC 6962 leaf hash of a logged command entry.
+func leafHash(certChain, signature []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x00}) // RFC 6962 leaf hash domain separation prefix
+	h.Write(certChain)
+	h.Write(signature)
+
+	return h.Sum(nil)
+}
+
+// verifyInclusion verifies that leafHash at index is included in a tree of size treeSize with
+// root rootHash, given the Merkle audit path hashes (leaf-to-root order), per the RFC 6962
+// inclusion proof algorithm.
+func verifyInclusion(leafHash []byte, index uint64, hashes [][]byte, treeSize uint64, rootHash []byte) error {
+	if index >= treeSize {
+		return fmt.Errorf("leaf index %d is out of range for tree size %d", index, treeSize)
+	}
+
+	computed := leafHash
+	node, lastNode := index, treeSize-1
+	proofIndex := 0
+
+	for lastNode > 0 {
+		if proofIndex >= len(hashes) {
+			return fmt.Errorf("insufficient number of inclusion proof hashes")
+		}
+
+		switch {
+		case node%2 == 1:
+			computed = hashChildren(hashes[proofIndex], computed)
+			proofIndex++
+		case node < lastNode:
+			computed = hashChildren(computed, hashes[proofIndex])
+			proofIndex++
+		default:
+			// node == lastNode and node is a left child with no right sibling at this level.
+		}
+
+		node /= 2
+		lastNode /= 2
+	}
+
+	if proofIndex != len(hashes) {
+		return fmt.Errorf("inclusion proof has too many hashes")
+	}
+
+	if !bytes.Equal(computed, rootHash) {
+		return fmt.Errorf("computed root does not match checkpoint root hash")
+	}
+
+	return nil
+}
+
+// hashChildren computes the RFC 6962 interior node hash of a left and right child.
+func hashChildren(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x01}) // RFC 6962 interior node hash domain separation prefix
+	h.Write(left)
+	h.Write(right)
+
+	return h.Sum(nil)
+}
@@ -6,9 +6,88 @@
 package config
 
 const (
-	// MetalProviderAddressKernelArg is the kernel argument that contains the provider address.
+	// MetalProviderAddressKernelArg is the kernel argument that contains the provider address(es).
+	// It accepts a comma-separated list, e.g. "10.0.0.1:8080,10.0.0.2:8080": the agent tries each
+	// address in order, with the tunnel supervisor failing over to the next one if the active
+	// connection is unreachable or breaks.
 	MetalProviderAddressKernelArg = "metal.provider.address"
 
+	// MetalProviderTunnelStatusAddressKernelArg is the kernel argument that overrides the local
+	// address the tunnel supervisor's debug status endpoint listens on. Defaults to
+	// DefaultTunnelStatusAddress.
+	MetalProviderTunnelStatusAddressKernelArg = "metal.provider.tunnel-status-address"
+
+	// DefaultTunnelStatusAddress is the default local address the tunnel supervisor's debug status
+	// endpoint listens on.
+	DefaultTunnelStatusAddress = "127.0.0.1:8082"
+
+	// MetalProviderIdentityKernelArg is the kernel argument that overrides the identity the agent
+	// signs its requests to the provider as. When unset, the agent's Talos machine UUID is used.
+	// This is mainly useful for service-account-style setups where several agents share one
+	// registered identity/key pair instead of each provisioning their own.
+	MetalProviderIdentityKernelArg = "metal.provider.identity"
+
+	// MetalProviderSigningKeyPathKernelArg is the kernel argument that overrides the path the agent
+	// reads its long-lived request-signing keypair from (generating one there on first boot if
+	// missing). Defaults to DefaultSigningKeyPath.
+	MetalProviderSigningKeyPathKernelArg = "metal.provider.signing-key-path"
+
+	// DefaultSigningKeyPath is the default path for the agent's request-signing keypair.
+	DefaultSigningKeyPath = "/var/lib/talos-metal-agent/signing-key.asc"
+
+	// MetalProviderVerifyModeKernelArg is the kernel argument that selects how strictly the agent
+	// requires destructive provider commands (power control, disk wipes, reboots) to carry a valid
+	// signature and transparency log inclusion proof: "warn" logs a failure but still acts on the
+	// command, and "off" disables verification. Defaults to "off". "enforce" is not accepted: the
+	// agent fails to start when it is set.
+	MetalProviderVerifyModeKernelArg = "metal.provider.verify.mode"
+
+	// MetalProviderVerifyTrustRootKernelArg is the kernel argument that contains the path to a PEM
+	// bundle of root CA certificates that destructive commands' certificate chains must chain up
+	// to. Required unless MetalProviderVerifyModeKernelArg is "off".
+	MetalProviderVerifyTrustRootKernelArg = "metal.provider.verify.trust-root"
+
+	// MetalProviderVerifyLogURLKernelArg is the kernel argument that contains the URL of the
+	// transparency log destructive commands must be included in. It is also the origin expected
+	// in the log's signed checkpoints.
+	MetalProviderVerifyLogURLKernelArg = "metal.provider.verify.log-url"
+
+	// MetalProviderVerifyLogPublicKeyKernelArg is the kernel argument that contains the
+	// transparency log's base64-encoded Ed25519 checkpoint-signing public key.
+	MetalProviderVerifyLogPublicKeyKernelArg = "metal.provider.verify.log-public-key"
+
 	// TestModeKernelArg is the kernel argument that contains the test mode flag.
 	TestModeKernelArg = "metal.provider.test.mode"
+
+	// SideroLinkAPIKernelArg is the kernel argument that contains the SideroLink API endpoint.
+	//
+	// When present, the agent brings up a WireGuard tunnel to the provider via SideroLink instead of
+	// dialing the provider address directly.
+	SideroLinkAPIKernelArg = "siderolink.api"
+
+	// BMCBackendKernelArg is the kernel argument that selects the BMC backend ("ipmi", "redfish",
+	// "null", or "auto"). When unset, the agent auto-detects the backend.
+	BMCBackendKernelArg = "metal.bmc.backend"
+
+	// BMCRedfishAddressKernelArg is the kernel argument that contains the BMC's Redfish address,
+	// e.g. "192.168.1.1:443". Required to use the Redfish backend, as unlike IPMI it isn't
+	// locally discoverable.
+	BMCRedfishAddressKernelArg = "metal.bmc.redfish.address"
+
+	// BMCRedfishSchemeKernelArg is the kernel argument that selects the URL scheme ("http" or
+	// "https") used to reach the BMC's Redfish API. Defaults to "https".
+	BMCRedfishSchemeKernelArg = "metal.bmc.redfish.scheme"
+
+	// BMCRedfishUsernameKernelArg is the kernel argument that contains the username the agent uses
+	// to authenticate against the BMC's Redfish API.
+	BMCRedfishUsernameKernelArg = "metal.bmc.redfish.username"
+
+	// BMCRedfishPasswordKernelArg is the kernel argument that contains the password the agent uses
+	// to authenticate against the BMC's Redfish API.
+	BMCRedfishPasswordKernelArg = "metal.bmc.redfish.password"
+
+	// BMCRedfishInsecureSkipVerifyKernelArg is the kernel argument that disables TLS certificate
+	// verification for the Redfish backend, which many BMCs require as they ship with a
+	// self-signed certificate.
+	BMCRedfishInsecureSkipVerifyKernelArg = "metal.bmc.redfish.insecure-skip-verify"
 )
@@ -0,0 +1,164 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package siderolink brings up a SideroLink WireGuard tunnel to the metal provider.
+//
+// It is used as an alternative to a plain TCP dial when the agent only has NAT-traversing or
+// otherwise non-routable connectivity to the provider: the agent generates a keypair, exchanges
+// it with the provider's provision endpoint for a peer configuration, and brings up a userspace
+// WireGuard interface that the reverse tunnel is then dialed over.
+package siderolink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun/netstack"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// provisionTimeout bounds how long Provision waits for the provider's SideroLink API to respond.
+const provisionTimeout = 30 * time.Second
+
+// provisionHTTPClient is used for all SideroLink provision requests. A bounded timeout keeps a
+// stalled or unreachable provider from hanging the agent's startup indefinitely.
+var provisionHTTPClient = &http.Client{Timeout: provisionTimeout}
+
+// PeerConfig is the WireGuard peer configuration returned by the provider's provision endpoint.
+type PeerConfig struct {
+	ServerPublicKey string   `json:"server_public_key"`
+	ServerEndpoint  string   `json:"server_endpoint"`
+	Address         string   `json:"address"`
+	AllowedIPs      []string `json:"allowed_ips"`
+}
+
+type provisionRequest struct {
+	MachineID string `json:"machine_id"`
+	PublicKey string `json:"public_key"`
+}
+
+// GenerateKeyPair generates a new WireGuard keypair for the agent to present to the provider.
+func GenerateKeyPair() (privateKey, publicKey wgtypes.Key, err error) {
+	privateKey, err = wgtypes.GeneratePrivateKey()
+	if err != nil {
+		return wgtypes.Key{}, wgtypes.Key{}, fmt.Errorf("failed to generate WireGuard private key: %w", err)
+	}
+
+	return privateKey, privateKey.PublicKey(), nil
+}
+
+// Provision exchanges the agent's public key and machine ID for a peer configuration with the
+// provider's SideroLink provision endpoint.
+func Provision(ctx context.Context, apiEndpoint, machineID string, publicKey wgtypes.Key) (*PeerConfig, error) {
+	body, err := json.Marshal(provisionRequest{
+		MachineID: machineID,
+		PublicKey: publicKey.String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal provision request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, apiEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build provision request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := provisionHTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach SideroLink API %q: %w", apiEndpoint, err)
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("SideroLink API %q returned status %d", apiEndpoint, resp.StatusCode)
+	}
+
+	var peer PeerConfig
+
+	if err = json.NewDecoder(resp.Body).Decode(&peer); err != nil {
+		return nil, fmt.Errorf("failed to decode provision response: %w", err)
+	}
+
+	return &peer, nil
+}
+
+// Link is a live userspace WireGuard tunnel to the provider.
+type Link struct {
+	dev *device.Device
+	net *netstack.Net
+}
+
+// Up brings up a userspace WireGuard interface configured with privateKey as the local identity
+// and peer as the single remote peer, and returns a Link whose DialContext can be used to reach
+// the provider over the tunnel.
+func Up(privateKey wgtypes.Key, peer PeerConfig) (*Link, error) {
+	localAddr, err := netip.ParseAddr(peer.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse local address %q: %w", peer.Address, err)
+	}
+
+	tunDevice, tnet, err := netstack.CreateNetTUN([]netip.Addr{localAddr}, nil, device.DefaultMTU)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create userspace WireGuard TUN device: %w", err)
+	}
+
+	dev := device.NewDevice(tunDevice, conn.NewDefaultBind(), device.NewLogger(device.LogLevelError, "siderolink: "))
+
+	config, err := ipcConfig(privateKey, peer)
+	if err != nil {
+		dev.Close()
+
+		return nil, fmt.Errorf("failed to build WireGuard device config: %w", err)
+	}
+
+	if err = dev.IpcSet(config); err != nil {
+		dev.Close()
+
+		return nil, fmt.Errorf("failed to configure WireGuard device: %w", err)
+	}
+
+	if err = dev.Up(); err != nil {
+		dev.Close()
+
+		return nil, fmt.Errorf("failed to bring up WireGuard device: %w", err)
+	}
+
+	return &Link{dev: dev, net: tnet}, nil
+}
+
+// DialContext dials addr over the WireGuard tunnel.
+func (l *Link) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return l.net.DialContext(ctx, network, addr)
+}
+
+// Close tears down the WireGuard device.
+func (l *Link) Close() {
+	l.dev.Close()
+}
+
+func ipcConfig(privateKey wgtypes.Key, peer PeerConfig) (string, error) {
+	serverPublicKey, err := wgtypes.ParseKey(peer.ServerPublicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse server public key %q: %w", peer.ServerPublicKey, err)
+	}
+
+	config := fmt.Sprintf("private_key=%x\npublic_key=%x\nendpoint=%s\n", privateKey, serverPublicKey, peer.ServerEndpoint)
+
+	for _, allowedIP := range peer.AllowedIPs {
+		config += fmt.Sprintf("allowed_ip=%s\n", allowedIP)
+	}
+
+	return config, nil
+}